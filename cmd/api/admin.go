@@ -0,0 +1,223 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/thats-insane/comments/internal/data"
+	"github.com/thats-insane/comments/internal/validator"
+)
+
+func (a *appDependencies) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+	var queryParametersData struct {
+		Email     string
+		Username  string
+		Activated *bool
+		data.Filters
+	}
+
+	queryParameters := r.URL.Query()
+
+	v := validator.New()
+
+	queryParametersData.Email = a.getSingleQueryParameters(queryParameters, "email", "")
+	queryParametersData.Username = a.getSingleQueryParameters(queryParameters, "username", "")
+
+	if queryParameters.Has("activated") {
+		activated := a.getSingleBooleanParameters(queryParameters, "activated", false, v)
+		queryParametersData.Activated = &activated
+	}
+
+	queryParametersData.Filters.Page = a.getSingleIntegerParameters(queryParameters, "page", 1, v)
+	queryParametersData.Filters.PageSize = a.getSingleIntegerParameters(queryParameters, "page_size", 20, v)
+	queryParametersData.Filters.Sort = a.getSingleQueryParameters(queryParameters, "sort", "id")
+	queryParametersData.Filters.SortSafelist = []string{"id", "-id", "created_at", "-created_at", "username", "-username", "email", "-email"}
+
+	data.ValidateFilters(v, queryParametersData.Filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	users, metadata, err := a.userModel.GetAll(queryParametersData.Email, queryParametersData.Username, queryParametersData.Activated, queryParametersData.Filters)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"users":    users,
+		"metadata": metadata,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) displayUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	user, err := a.userModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	roles, err := a.roleModel.GetForUser(user.ID)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	perms, err := a.permsModel.GetAll(user.ID)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	if perms == nil {
+		perms = data.Perms{}
+	}
+
+	data := envelope{
+		"user":        user,
+		"roles":       roles,
+		"permissions": perms,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// deactivateUserHandler disables a user's account and signs them out.
+func (a *appDependencies) deactivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	a.setUserDisabled(w, r, true)
+}
+
+func (a *appDependencies) reactivateUserHandler(w http.ResponseWriter, r *http.Request) {
+	a.setUserDisabled(w, r, false)
+}
+
+func (a *appDependencies) setUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	user, err := a.userModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.userModel.SetDisabled(user, disabled)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	if disabled {
+		err = a.tokenModel.DeleteAllScopesForUser(user.ID)
+		if err != nil {
+			a.serverErrResponse(w, r, err)
+			return
+		}
+	}
+
+	data := envelope{
+		"user": user,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// logoutUserHandler revokes every token the user holds, signing them out of
+// every session.
+func (a *appDependencies) logoutUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	user, err := a.userModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.tokenModel.DeleteAllScopesForUser(user.ID)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"message": "the user has been signed out of every session",
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	err = a.userModel.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"message": "user successfully deleted",
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
@@ -4,15 +4,21 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 
 	"github.com/thats-insane/comments/internal/data"
+	"github.com/thats-insane/comments/internal/filter"
+	"github.com/thats-insane/comments/internal/markup"
 	"github.com/thats-insane/comments/internal/validator"
 )
 
 func (a *appDependencies) createCommentHandler(w http.ResponseWriter, r *http.Request) {
 	var incomingData struct {
-		Content string `json:"content"`
-		Author  string `json:"author"`
+		ThreadKey string `json:"thread_key"`
+		ParentID  *int64 `json:"parent_id"`
+		Content   string `json:"content"`
+		Format    string `json:"format"`
 	}
 
 	err := a.readJSON(w, r, &incomingData)
@@ -21,28 +27,130 @@ func (a *appDependencies) createCommentHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	threadKey := incomingData.ThreadKey
+
+	user := a.contextGetUser(r)
+
 	comment := &data.Comment{
-		Content: incomingData.Content,
-		Author:  incomingData.Author,
+		ParentID: incomingData.ParentID,
+		UserID:   &user.ID,
+		Content:  incomingData.Content,
+		Format:   incomingData.Format,
+		Author:   user.Username,
+	}
+
+	if comment.Format == "" {
+		comment.Format = markup.Plain
 	}
 
 	v := validator.New()
 
 	data.ValidateComment(v, comment)
 
+	var parent *data.Comment
+	if comment.ParentID != nil {
+		parent, err = a.commentModel.Get(*comment.ParentID)
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			a.serverErrResponse(w, r, err)
+			return
+		}
+
+		visible := false
+		if parent != nil {
+			visible, err = a.canViewComment(user, parent)
+			if err != nil {
+				a.serverErrResponse(w, r, err)
+				return
+			}
+		}
+
+		v.Check(visible, "parent_id", "must reference an existing comment")
+	}
+
+	if threadKey != "" || comment.ParentID == nil {
+		data.ValidateThreadKey(v, threadKey)
+	}
+
 	if !v.IsEmpty() {
 		a.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
+	// Replies inherit the thread of their parent; top-level comments create
+	// the thread on first use.
+	var thread *data.Thread
+	if parent != nil {
+		thread, err = a.threadModel.Get(parent.ThreadID)
+	} else {
+		thread, err = a.threadModel.GetOrCreate(threadKey)
+	}
+
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	if threadKey != "" && thread.Key != threadKey {
+		v.AddError("parent_id", "must belong to the same thread")
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	comment.ThreadID = thread.ID
+
+	comment.Status, err = a.initialCommentStatus(user, thread)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	screening, err := a.screenComment(user, comment)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	switch screening.Verdict {
+	case filter.Reject:
+		v.AddError("content", screening.Reason)
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	case filter.Hold:
+		reason := heldReason(screening)
+		comment.Status = data.CommentPending
+		comment.ModerationReason = &reason
+	}
+
 	err = a.commentModel.Insert(comment)
 	if err != nil {
 		a.serverErrResponse(w, r, err)
 		return
 	}
 
+	err = a.recordMentions(comment)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	// Authors hear about replies to their comments unless they opt out.
+	err = a.subscriptionModel.Upsert(&data.Subscription{UserID: user.ID, CommentID: &comment.ID, Mode: data.DeliveryImmediate})
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	a.notifySubscribers(comment)
+
 	headers := make(http.Header)
 	headers.Set("Location", fmt.Sprintf("/v1/comments/%d", comment.ID))
+	headers.Set("ETag", commentETag(comment))
+
+	err = a.decorateComments(r, comment)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
 
 	data := envelope{
 		"comment": comment,
@@ -54,8 +162,6 @@ func (a *appDependencies) createCommentHandler(w http.ResponseWriter, r *http.Re
 		a.serverErrResponse(w, r, err)
 		return
 	}
-
-	fmt.Fprintf(w, "%+v\n", incomingData)
 }
 
 func (a *appDependencies) displayCommentHandler(w http.ResponseWriter, r *http.Request) {
@@ -79,11 +185,40 @@ func (a *appDependencies) displayCommentHandler(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	visible, err := a.canViewComment(a.contextGetUser(r), comment)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	if !visible {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	etag := commentETag(comment)
+
+	ifNoneMatch := r.Header.Get("If-None-Match")
+	if ifNoneMatch != "" && etagMatches(ifNoneMatch, etag, true) {
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag)
+
+	err = a.decorateComments(r, comment)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
 	data := envelope{
 		"comment": comment,
 	}
 
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeJSON(w, http.StatusOK, data, headers)
 	if err != nil {
 		a.serverErrResponse(w, r, err)
 		return
@@ -111,9 +246,34 @@ func (a *appDependencies) updateCommentHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	user := a.contextGetUser(r)
+
+	allowed, err := a.canModifyComment(user, comment)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	if !allowed {
+		a.notPermittedResponse(w, r)
+		return
+	}
+
+	expectedVersion := r.Header.Get("X-Expected-Version")
+	if expectedVersion != "" && expectedVersion != strconv.FormatInt(int64(comment.Version), 10) {
+		a.editConflictResponse(w, r)
+		return
+	}
+
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch != "" && !etagMatches(ifMatch, commentETag(comment), false) {
+		a.preconditionFailedResponse(w, r)
+		return
+	}
+
 	var incomingData struct {
 		Content *string `json:"content"`
-		Author  *string `json:"author"`
+		Format  *string `json:"format"`
 	}
 
 	err = a.readJSON(w, r, &incomingData)
@@ -127,8 +287,71 @@ func (a *appDependencies) updateCommentHandler(w http.ResponseWriter, r *http.Re
 		comment.Content = *incomingData.Content
 	}
 
-	err = a.commentModel.Update(comment)
+	if incomingData.Format != nil {
+		comment.Format = *incomingData.Format
+	}
+
+	v := validator.New()
+
+	data.ValidateComment(v, comment)
+
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	screening, err := a.screenComment(user, comment)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	if screening.Verdict == filter.Reject {
+		v.AddError("content", screening.Reason)
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.commentModel.Update(comment, user.ID)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	// An edit that trips the filter takes a published comment back to the
+	// moderation queue.
+	if screening.Verdict == filter.Hold && comment.Status == data.CommentApproved {
+		reason := heldReason(screening)
+
+		err = a.commentModel.Hide(comment.ID, reason, false)
+		if err != nil {
+			a.serverErrResponse(w, r, err)
+			return
+		}
 
+		comment, err = a.commentModel.Get(comment.ID)
+		if err != nil {
+			a.serverErrResponse(w, r, err)
+			return
+		}
+	}
+
+	err = a.recordMentions(comment)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", commentETag(comment))
+
+	err = a.decorateComments(r, comment)
 	if err != nil {
 		a.serverErrResponse(w, r, err)
 		return
@@ -138,7 +361,7 @@ func (a *appDependencies) updateCommentHandler(w http.ResponseWriter, r *http.Re
 		"comment": comment,
 	}
 
-	err = a.writeJSON(w, http.StatusOK, data, nil)
+	err = a.writeJSON(w, http.StatusOK, data, headers)
 	if err != nil {
 		a.serverErrResponse(w, r, err)
 		return
@@ -153,6 +376,30 @@ func (a *appDependencies) deleteCommentHandler(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	comment, err := a.commentModel.Get(id)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+
+		return
+	}
+
+	allowed, err := a.canModifyComment(a.contextGetUser(r), comment)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	if !allowed {
+		a.notPermittedResponse(w, r)
+		return
+	}
+
 	err = a.commentModel.Delete(id)
 
 	if err != nil {
@@ -189,8 +436,13 @@ func (a *appDependencies) listCommentsHandler(w http.ResponseWriter, r *http.Req
 
 	v := validator.New()
 
-	queryParametersData.Filters.Page = a.getSingleIntegerParameters(queryParameters, "page", 1, v)
-	queryParametersData.Filters.PageSize = a.getSingleIntegerParameters(queryParameters, "page_size", 10, v)
+	queryParametersData.Filters = a.readCommentFilters(queryParameters, v)
+	tree, depth := a.readTreeParameters(queryParameters, v)
+
+	threadKey := a.readThreadKeyParam(r, "thread")
+	if threadKey != "" {
+		data.ValidateThreadKey(v, threadKey)
+	}
 
 	data.ValidateFilters(v, queryParametersData.Filters)
 	if !v.IsEmpty() {
@@ -198,8 +450,161 @@ func (a *appDependencies) listCommentsHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	comments, err := a.commentModel.GetAll(queryParametersData.Content, queryParametersData.Author, queryParametersData.Filters)
+	var threadID int64
+	if threadKey != "" {
+		thread, err := a.threadModel.GetByKey(threadKey)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				// Threads only exist once commented on, so an unknown key is
+				// simply a thread without comments.
+				err = a.writeJSON(w, http.StatusOK, envelope{"comments": []*data.Comment{}, "metadata": data.Metadata{}}, nil)
+				if err != nil {
+					a.serverErrResponse(w, r, err)
+				}
+			default:
+				a.serverErrResponse(w, r, err)
+			}
+			return
+		}
+		threadID = thread.ID
+	}
+
+	comments, metadata, err := a.commentModel.GetAll(threadID, queryParametersData.Content, queryParametersData.Author, tree, queryParametersData.Filters)
+
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	if tree {
+		err = a.nestReplies(comments, depth)
+		if err != nil {
+			a.serverErrResponse(w, r, err)
+			return
+		}
+	}
+
+	err = a.decorateComments(r, comments...)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"comments": comments,
+		"metadata": metadata,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) listRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	parent, err := a.commentModel.Get(id)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+
+		return
+	}
+
+	visible, err := a.canViewComment(a.contextGetUser(r), parent)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	if !visible {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	queryParameters := r.URL.Query()
+
+	v := validator.New()
+
+	filters := a.readCommentFilters(queryParameters, v)
+	tree, depth := a.readTreeParameters(queryParameters, v)
+
+	data.ValidateFilters(v, filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	replies, metadata, err := a.commentModel.GetReplies(id, filters)
+
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	if tree {
+		err = a.nestReplies(replies, depth)
+		if err != nil {
+			a.serverErrResponse(w, r, err)
+			return
+		}
+	}
+
+	err = a.decorateComments(r, replies...)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"replies":  replies,
+		"metadata": metadata,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) listTrashHandler(w http.ResponseWriter, r *http.Request) {
+	var filters data.Filters
+
+	queryParameters := r.URL.Query()
+
+	v := validator.New()
+
+	filters.Page = a.getSingleIntegerParameters(queryParameters, "page", 1, v)
+	filters.PageSize = a.getSingleIntegerParameters(queryParameters, "page_size", 10, v)
+
+	data.ValidateFilters(v, filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	comments, err := a.commentModel.GetTrash(filters)
+
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
 
+	err = a.decorateComments(r, comments...)
 	if err != nil {
 		a.serverErrResponse(w, r, err)
 		return
@@ -215,3 +620,151 @@ func (a *appDependencies) listCommentsHandler(w http.ResponseWriter, r *http.Req
 		a.serverErrResponse(w, r, err)
 	}
 }
+
+func (a *appDependencies) restoreCommentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	err = a.commentModel.Restore(id)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+
+		return
+	}
+
+	comment, err := a.commentModel.Get(id)
+
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", commentETag(comment))
+
+	err = a.decorateComments(r, comment)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"comment": comment,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, headers)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// readCommentFilters reads the pagination and sort parameters shared by the
+// comment listings. A listing is paged either by page number or by one of the
+// after and before cursors returned in its metadata.
+func (a *appDependencies) readCommentFilters(queryParameters url.Values, v *validator.Validator) data.Filters {
+	return data.Filters{
+		Page:         a.getSingleIntegerParameters(queryParameters, "page", 1, v),
+		PageSize:     a.getSingleIntegerParameters(queryParameters, "page_size", 10, v),
+		Sort:         a.getSingleQueryParameters(queryParameters, "sort", "id"),
+		SortSafelist: []string{"id", "-id", "created_at", "-created_at", "score", "-score"},
+		After:        a.getSingleQueryParameters(queryParameters, "after", ""),
+		Before:       a.getSingleQueryParameters(queryParameters, "before", ""),
+	}
+}
+
+// readTreeParameters reads the tree and depth query parameters. The depth
+// defaults to, and may not exceed, the configured maximum reply depth.
+func (a *appDependencies) readTreeParameters(queryParameters url.Values, v *validator.Validator) (bool, int) {
+	tree := a.getSingleBooleanParameters(queryParameters, "tree", false, v)
+	depth := a.getSingleIntegerParameters(queryParameters, "depth", a.config.comments.maxDepth, v)
+
+	v.Check(depth > 0, "depth", "must be greater than zero")
+	v.Check(depth <= a.config.comments.maxDepth, "depth", fmt.Sprintf("must be a maximum of %d", a.config.comments.maxDepth))
+
+	return tree, depth
+}
+
+func (a *appDependencies) nestReplies(comments []*data.Comment, depth int) error {
+	parentIDs := make([]int64, len(comments))
+	for i, comment := range comments {
+		parentIDs[i] = comment.ID
+	}
+
+	descendants, err := a.commentModel.GetDescendants(parentIDs, depth)
+	if err != nil {
+		return err
+	}
+
+	data.NestReplies(comments, descendants)
+
+	return nil
+}
+
+// decorateComments fills in the fields of the comments, and of every reply
+// nested beneath them, that are not stored: the rendered HTML and those that
+// depend on the requesting user.
+func (a *appDependencies) decorateComments(r *http.Request, comments ...*data.Comment) error {
+	user := a.contextGetUser(r)
+
+	all := data.Flatten(comments)
+
+	for _, comment := range all {
+		html, err := markup.Render(comment.Format, comment.Content)
+		if err != nil {
+			return err
+		}
+
+		comment.ContentHTML = html
+	}
+
+	err := a.mentionModel.Attach(all)
+	if err != nil {
+		return err
+	}
+
+	return a.reactionModel.Attach(all, user.ID)
+}
+
+// commentETag returns a strong entity tag for the comment. Its entity tag
+// version is bumped on every update, moderation decision and reaction, so
+// together with the id it identifies the representation. my_reactions
+// differs between users, which is covered by the Vary: Authorization set in
+// authenticate.
+func commentETag(comment *data.Comment) string {
+	return fmt.Sprintf(`"%d-%d"`, comment.ID, comment.ETagVersion)
+}
+
+// canViewComment reports whether the user may see the comment. Comments
+// that have not been approved are only shown to their author and moderators.
+func (a *appDependencies) canViewComment(user *data.User, comment *data.Comment) (bool, error) {
+	if comment.Status == data.CommentApproved {
+		return true, nil
+	}
+
+	return a.canModifyComment(user, comment)
+}
+
+// canModifyComment reports whether the user may edit or delete the comment,
+// which is limited to its author and holders of comments:moderate.
+func (a *appDependencies) canModifyComment(user *data.User, comment *data.Comment) (bool, error) {
+	if comment.UserID != nil && *comment.UserID == user.ID {
+		return true, nil
+	}
+
+	perms, err := a.permsModel.GetAll(user.ID)
+	if err != nil {
+		return false, err
+	}
+
+	return perms.Include("comments:moderate"), nil
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/thats-insane/comments/internal/data"
+)
+
+func TestListCommentsByThreadKey(t *testing.T) {
+	app := newTestApplication(t)
+
+	_, token := app.newTestUser(t, "alice", "comments:read", "comments:write")
+
+	key := "https://example.com/blog/2024/hello-world?ref=home"
+
+	created := app.createTestComment(t, token, `{"thread_key": "`+key+`", "content": "first"}`)
+	app.createTestComment(t, token, `{"thread_key": "/blog/other", "content": "elsewhere"}`)
+
+	res := app.do(t, http.MethodGet, "/v1/comments?thread="+url.QueryEscape(key), token, "")
+	res.expectStatus(t, http.StatusOK)
+
+	var listed struct {
+		Comments []struct {
+			ID int64 `json:"id"`
+		} `json:"comments"`
+	}
+	res.decode(t, &listed)
+
+	if len(listed.Comments) != 1 || listed.Comments[0].ID != created.Comment.ID {
+		t.Errorf("got comments %+v; want only %d", listed.Comments, created.Comment.ID)
+	}
+
+	res = app.do(t, http.MethodGet, "/v1/comments?thread="+url.QueryEscape("/blog/unknown"), token, "")
+	res.expectStatus(t, http.StatusOK)
+
+	res.decode(t, &listed)
+	if len(listed.Comments) != 0 {
+		t.Errorf("got comments %+v for a thread without any", listed.Comments)
+	}
+}
+
+func TestReplies(t *testing.T) {
+	app := newTestApplication(t)
+
+	_, token := app.newTestUser(t, "alice", "comments:read", "comments:write")
+
+	parent := app.createTestComment(t, token, `{"thread_key": "replies", "content": "parent"}`)
+	reply := app.createTestComment(t, token, fmt.Sprintf(`{"parent_id": %d, "content": "reply"}`, parent.Comment.ID))
+	nested := app.createTestComment(t, token, fmt.Sprintf(`{"parent_id": %d, "content": "nested"}`, reply.Comment.ID))
+
+	if reply.Comment.ThreadID != parent.Comment.ThreadID {
+		t.Errorf("reply is in thread %d; want its parent's thread %d", reply.Comment.ThreadID, parent.Comment.ThreadID)
+	}
+
+	res := app.do(t, http.MethodPost, "/v1/comments", token, `{"parent_id": 9999, "content": "orphan"}`)
+	res.expectStatus(t, http.StatusUnprocessableEntity)
+
+	res = app.do(t, http.MethodPost, "/v1/comments", token, fmt.Sprintf(`{"thread_key": "elsewhere", "parent_id": %d, "content": "stray"}`, parent.Comment.ID))
+	res.expectStatus(t, http.StatusUnprocessableEntity)
+
+	res = app.do(t, http.MethodGet, fmt.Sprintf("/v1/comments/%d/replies", parent.Comment.ID), token, "")
+	res.expectStatus(t, http.StatusOK)
+
+	var replies struct {
+		Replies []struct {
+			ID int64 `json:"id"`
+		} `json:"replies"`
+	}
+	res.decode(t, &replies)
+
+	if len(replies.Replies) != 1 || replies.Replies[0].ID != reply.Comment.ID {
+		t.Errorf("got replies %+v; want only %d", replies.Replies, reply.Comment.ID)
+	}
+
+	res = app.do(t, http.MethodGet, "/v1/comments?thread=replies&tree=true", token, "")
+	res.expectStatus(t, http.StatusOK)
+
+	type node struct {
+		ID      int64   `json:"id"`
+		Replies []*node `json:"replies"`
+	}
+
+	var tree struct {
+		Comments []*node `json:"comments"`
+	}
+	res.decode(t, &tree)
+
+	if len(tree.Comments) != 1 || len(tree.Comments[0].Replies) != 1 || len(tree.Comments[0].Replies[0].Replies) != 1 {
+		t.Fatalf("got tree %s; want parent > reply > nested", res.body)
+	}
+
+	if got := tree.Comments[0].Replies[0].Replies[0].ID; got != nested.Comment.ID {
+		t.Errorf("got nested reply %d; want %d", got, nested.Comment.ID)
+	}
+
+	res = app.do(t, http.MethodGet, "/v1/comments?thread=replies&tree=true&depth=1", token, "")
+	res.expectStatus(t, http.StatusOK)
+
+	res.decode(t, &tree)
+	if len(tree.Comments) != 1 || len(tree.Comments[0].Replies) != 1 || len(tree.Comments[0].Replies[0].Replies) != 0 {
+		t.Errorf("got tree %s; want replies one level deep", res.body)
+	}
+}
+
+func TestCommentOwnership(t *testing.T) {
+	app := newTestApplication(t)
+
+	alice, aliceToken := app.newTestUser(t, "alice", "comments:read", "comments:write")
+	_, bobToken := app.newTestUser(t, "bob", "comments:read", "comments:write")
+	_, modToken := app.newTestUser(t, "mod", "comments:read", "comments:write", "comments:moderate")
+
+	created := app.createTestComment(t, aliceToken, `{"thread_key": "ownership", "content": "mine"}`)
+
+	if created.Comment.UserID == nil || *created.Comment.UserID != alice.ID || created.Comment.Author != "alice" {
+		t.Fatalf("comment is owned by %v (%q); want alice", created.Comment.UserID, created.Comment.Author)
+	}
+
+	path := fmt.Sprintf("/v1/comments/%d", created.Comment.ID)
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"anonymous", "", http.StatusUnauthorized},
+		{"another user", bobToken, http.StatusForbidden},
+		{"author", aliceToken, http.StatusOK},
+		{"moderator", modToken, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := app.do(t, http.MethodPatch, path, tt.token, `{"content": "edited by `+tt.name+`"}`)
+			res.expectStatus(t, tt.status)
+		})
+	}
+
+	res := app.do(t, http.MethodDelete, path, bobToken, "")
+	res.expectStatus(t, http.StatusForbidden)
+
+	res = app.do(t, http.MethodDelete, path, aliceToken, "")
+	res.expectStatus(t, http.StatusOK)
+}
+
+func TestCommentPreconditions(t *testing.T) {
+	app := newTestApplication(t)
+
+	_, token := app.newTestUser(t, "alice", "comments:read", "comments:write")
+
+	created := app.createTestComment(t, token, `{"thread_key": "preconditions", "content": "original"}`)
+	path := fmt.Sprintf("/v1/comments/%d", created.Comment.ID)
+
+	res := app.do(t, http.MethodGet, path, token, "")
+	res.expectStatus(t, http.StatusOK)
+
+	etag := res.header.Get("ETag")
+	if etag == "" {
+		t.Fatal("no ETag on the comment")
+	}
+
+	res = app.do(t, http.MethodGet, path, token, "", "If-None-Match", etag)
+	res.expectStatus(t, http.StatusNotModified)
+
+	res = app.do(t, http.MethodPatch, path, token, `{"content": "stale"}`, "If-Match", `"0-0"`)
+	res.expectStatus(t, http.StatusPreconditionFailed)
+
+	res = app.do(t, http.MethodPatch, path, token, `{"content": "stale"}`, "X-Expected-Version", "99")
+	res.expectStatus(t, http.StatusConflict)
+
+	res = app.do(t, http.MethodPatch, path, token, `{"content": "first edit"}`, "If-Match", etag)
+	res.expectStatus(t, http.StatusOK)
+
+	newETag := res.header.Get("ETag")
+	if newETag == "" || newETag == etag {
+		t.Fatalf("edit changed the ETag from %s to %q", etag, newETag)
+	}
+
+	// A client still holding the old representation must not overwrite the
+	// edit.
+	res = app.do(t, http.MethodPatch, path, token, `{"content": "lost update"}`, "If-Match", etag)
+	res.expectStatus(t, http.StatusPreconditionFailed)
+
+	res = app.do(t, http.MethodGet, path, token, "", "If-None-Match", etag)
+	res.expectStatus(t, http.StatusOK)
+
+	var updated commentResponse
+	res.decode(t, &updated)
+
+	if updated.Comment.Content != "first edit" || updated.Comment.Version != created.Comment.Version+1 {
+		t.Errorf("got %q at version %d; want the first edit at version %d", updated.Comment.Content, updated.Comment.Version, created.Comment.Version+1)
+	}
+
+	res = app.do(t, http.MethodPatch, path, token, `{"content": "second edit"}`, "X-Expected-Version", fmt.Sprint(updated.Comment.Version))
+	res.expectStatus(t, http.StatusOK)
+
+	// Two writers starting from the same version: the second loses.
+	comment, err := app.commentModel.Get(created.Comment.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stale := *comment
+
+	comment.Content = "winner"
+	err = app.commentModel.Update(comment, *comment.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stale.Content = "loser"
+	err = app.commentModel.Update(&stale, *stale.UserID)
+	if !errors.Is(err, data.ErrEditConflict) {
+		t.Errorf("got %v for a stale update; want ErrEditConflict", err)
+	}
+}
+
+func TestTrashAndRestore(t *testing.T) {
+	app := newTestApplication(t)
+
+	_, aliceToken := app.newTestUser(t, "alice", "comments:read", "comments:write")
+	_, modToken := app.newTestUser(t, "mod", "comments:read", "comments:moderate")
+
+	parent := app.createTestComment(t, aliceToken, `{"thread_key": "trash", "content": "parent"}`)
+	reply := app.createTestComment(t, aliceToken, fmt.Sprintf(`{"parent_id": %d, "content": "reply"}`, parent.Comment.ID))
+
+	path := fmt.Sprintf("/v1/comments/%d", parent.Comment.ID)
+
+	res := app.do(t, http.MethodGet, path, aliceToken, "")
+	res.expectStatus(t, http.StatusOK)
+
+	etag := res.header.Get("ETag")
+
+	res = app.do(t, http.MethodDelete, path, aliceToken, "")
+	res.expectStatus(t, http.StatusOK)
+
+	res = app.do(t, http.MethodGet, path, aliceToken, "")
+	res.expectStatus(t, http.StatusNotFound)
+
+	res = app.do(t, http.MethodDelete, path, aliceToken, "")
+	res.expectStatus(t, http.StatusNotFound)
+
+	res = app.do(t, http.MethodGet, "/v1/moderation/trash", aliceToken, "")
+	res.expectStatus(t, http.StatusForbidden)
+
+	res = app.do(t, http.MethodGet, "/v1/moderation/trash", modToken, "")
+	res.expectStatus(t, http.StatusOK)
+
+	var trash struct {
+		Comments []struct {
+			ID        int64   `json:"id"`
+			DeletedAt *string `json:"deleted_at"`
+		} `json:"comments"`
+	}
+	res.decode(t, &trash)
+
+	if len(trash.Comments) != 1 || trash.Comments[0].ID != parent.Comment.ID || trash.Comments[0].DeletedAt == nil {
+		t.Fatalf("got trash %s; want only the deleted parent", res.body)
+	}
+
+	// The parent has a live reply, so purging must leave it restorable.
+	purged, err := app.commentModel.Purge(-time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if purged != 0 {
+		t.Errorf("purged %d comments; want none while the reply is live", purged)
+	}
+
+	res = app.do(t, http.MethodPost, path+"/restore", modToken, "")
+	res.expectStatus(t, http.StatusOK)
+
+	if res.header.Get("ETag") == etag {
+		t.Errorf("restoring kept the ETag %s from before the delete", etag)
+	}
+
+	res = app.do(t, http.MethodGet, path, aliceToken, "", "If-None-Match", etag)
+	res.expectStatus(t, http.StatusOK)
+
+	res = app.do(t, http.MethodPost, path+"/restore", modToken, "")
+	res.expectStatus(t, http.StatusNotFound)
+
+	// A reply that is itself past the retention period no longer holds its
+	// parent back.
+	for _, id := range []int64{reply.Comment.ID, parent.Comment.ID} {
+		res = app.do(t, http.MethodDelete, fmt.Sprintf("/v1/comments/%d", id), aliceToken, "")
+		res.expectStatus(t, http.StatusOK)
+	}
+
+	purged, err = app.commentModel.Purge(-time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if purged != 2 {
+		t.Errorf("purged %d comments; want the parent and its reply", purged)
+	}
+
+	res = app.do(t, http.MethodPost, path+"/restore", modToken, "")
+	res.expectStatus(t, http.StatusNotFound)
+}
@@ -56,6 +56,21 @@ func (a *appDependencies) editConflictResponse(w http.ResponseWriter, r *http.Re
 	a.errResponseJSON(w, r, http.StatusConflict, message)
 }
 
+func (a *appDependencies) notPendingResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the comment is not awaiting moderation"
+	a.errResponseJSON(w, r, http.StatusConflict, message)
+}
+
+func (a *appDependencies) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the record has been modified since you last fetched it, fetch it again and retry"
+	a.errResponseJSON(w, r, http.StatusPreconditionFailed, message)
+}
+
+func (a *appDependencies) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid authentication credentials"
+	a.errResponseJSON(w, r, http.StatusUnauthorized, message)
+}
+
 func (a *appDependencies) invalidAuthorizationToken(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("WWW-Authenticate", "Bearer")
 	message := "invalid/missing authentication token"
@@ -76,3 +91,13 @@ func (a *appDependencies) notPermittedResponse(w http.ResponseWriter, r *http.Re
 	message := "your account does not have the necessary permissions to access this resource"
 	a.errResponseJSON(w, r, http.StatusForbidden, message)
 }
+
+func (a *appDependencies) emailNotDeadResponse(w http.ResponseWriter, r *http.Request) {
+	message := "only emails that have been dead-lettered, and whose data has not yet been scrubbed, can be retried"
+	a.errResponseJSON(w, r, http.StatusConflict, message)
+}
+
+func (a *appDependencies) accountDisabledResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account has been deactivated"
+	a.errResponseJSON(w, r, http.StatusForbidden, message)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/thats-insane/comments/internal/data"
+	"github.com/thats-insane/comments/internal/filter"
+)
+
+// classifierTrainingSize is how many approved and how many rejected
+// comments the spam classifier is trained on at startup.
+const classifierTrainingSize = 1000
+
+// newContentFilter builds the pipeline every new or edited comment passes
+// through, training the spam classifier on past moderation decisions.
+func (a *appDependencies) newContentFilter() error {
+	var bannedWords []string
+	if a.config.filter.bannedWords != "" {
+		file, err := os.Open(a.config.filter.bannedWords)
+		if err != nil {
+			return err
+		}
+
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line != "" && !strings.HasPrefix(line, "#") {
+				bannedWords = append(bannedWords, line)
+			}
+		}
+
+		err = scanner.Err()
+		if err != nil {
+			return err
+		}
+	}
+
+	a.classifier = filter.NewClassifier()
+
+	err := a.commentModel.GetModerated(classifierTrainingSize, a.classifier.Train)
+	if err != nil {
+		return err
+	}
+
+	a.contentFilter = filter.New(
+		filter.NewBannedWords(bannedWords),
+		&filter.LinkLimit{Max: a.config.filter.maxLinks},
+		&filter.Duplicate{Lookup: a.commentModel.HasDuplicate, Window: a.config.filter.duplicateWindow},
+		&filter.SpamClassifier{Classifier: a.classifier, Threshold: a.config.filter.spamThreshold},
+	)
+
+	return nil
+}
+
+// screenComment runs the comment through the content filter on behalf of
+// the user.
+func (a *appDependencies) screenComment(user *data.User, comment *data.Comment) (filter.Result, error) {
+	return a.contentFilter.Run(filter.Submission{
+		CommentID: comment.ID,
+		UserID:    user.ID,
+		Content:   comment.Content,
+	})
+}
+
+func heldReason(result filter.Result) string {
+	return fmt.Sprintf("held by %s filter: %s", result.Stage, result.Reason)
+}
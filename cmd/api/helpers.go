@@ -99,6 +99,28 @@ func (a *appDependencies) writeJSON(w http.ResponseWriter, status int, data enve
 	return nil
 }
 
+// etagMatches reports whether etag appears in the comma-separated list of
+// entity tags from an If-Match or If-None-Match header. If-Match requires
+// strong comparison, while If-None-Match ignores the W/ weakness prefix.
+func etagMatches(header string, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+
+		if candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (a *appDependencies) readIDParam(r *http.Request) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
 
@@ -110,6 +132,13 @@ func (a *appDependencies) readIDParam(r *http.Request) (int64, error) {
 	return id, nil
 }
 
+// readThreadKeyParam returns the thread key in the named query string
+// parameter. Keys are often page paths or URLs, so they cannot be carried in
+// a single path segment.
+func (a *appDependencies) readThreadKeyParam(r *http.Request, name string) string {
+	return r.URL.Query().Get(name)
+}
+
 func (a *appDependencies) getSingleQueryParameters(queryParameters url.Values, key string, defaultValue string) string {
 	result := queryParameters.Get(key)
 
@@ -144,6 +173,21 @@ func (a *appDependencies) getSingleIntegerParameters(queryParameters url.Values,
 	return intValue
 }
 
+func (a *appDependencies) getSingleBooleanParameters(queryParameters url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	result := queryParameters.Get(key)
+	if result == "" {
+		return defaultValue
+	}
+
+	boolValue, err := strconv.ParseBool(result)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+
+	return boolValue
+}
+
 func (a *appDependencies) background(fn func()) {
 	a.wg.Add(1)
 	go func() {
@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestEtagMatches(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		weak   bool
+		want   bool
+	}{
+		{"same tag", `"1-2"`, false, true},
+		{"different tag", `"1-3"`, false, false},
+		{"one of a list", `"1-1", "1-2"`, false, true},
+		{"wildcard", `*`, false, true},
+		{"weak tag, strong comparison", `W/"1-2"`, false, false},
+		{"weak tag, weak comparison", `W/"1-2"`, true, true},
+		{"unquoted", `1-2`, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := etagMatches(tt.header, `"1-2"`, tt.weak); got != tt.want {
+				t.Errorf("etagMatches(%q) = %t; want %t", tt.header, got, tt.want)
+			}
+		})
+	}
+}
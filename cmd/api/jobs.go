@@ -0,0 +1,76 @@
+package main
+
+import (
+	"time"
+
+	"github.com/thats-insane/comments/internal/data"
+)
+
+// purgeDeletedComments periodically hard-deletes comments that have been in
+// the trash for longer than the configured retention period.
+func (a *appDependencies) purgeDeletedComments() {
+	ticker := time.NewTicker(a.config.comments.purgeInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		purged, err := a.commentModel.Purge(a.config.comments.retention)
+		if err != nil {
+			a.logger.Error(err.Error())
+			continue
+		}
+
+		if purged > 0 {
+			a.logger.Info("purged deleted comments", "count", purged)
+		}
+	}
+}
+
+// digestCheckInterval is how often sendDigests looks for users whose digest
+// is due.
+const digestCheckInterval = 10 * time.Minute
+
+// sendDigests emails each user on digest delivery the new comments they have
+// been notified of, once the oldest of them has waited for the digest
+// interval. As that is worked out from the notifications themselves, digests
+// that fell due while the server was down go out as soon as it starts.
+func (a *appDependencies) sendDigests() {
+	ticker := time.NewTicker(min(digestCheckInterval, a.config.notifications.digestInterval))
+	defer ticker.Stop()
+
+	for {
+		sent, err := a.notificationModel.SendDigests(a.config.notifications.digestInterval, "comment_digest.tmpl", func(digest *data.Digest) map[string]any {
+			return map[string]any{
+				"username":       digest.User.Username,
+				"items":          digest.Items,
+				"unsubscribeURL": a.unsubscribeURL(digest.User.ID),
+			}
+		})
+		if err != nil {
+			a.logger.Error(err.Error())
+		}
+
+		if sent > 0 {
+			a.logger.Info("sent notification digests", "count", sent)
+		}
+
+		<-ticker.C
+	}
+}
+
+// deleteExpiredTokens periodically deletes tokens that have expired.
+func (a *appDependencies) deleteExpiredTokens() {
+	ticker := time.NewTicker(a.config.tokens.cleanupInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		deleted, err := a.tokenModel.DeleteExpired()
+		if err != nil {
+			a.logger.Error(err.Error())
+			continue
+		}
+
+		if deleted > 0 {
+			a.logger.Info("deleted expired tokens", "count", deleted)
+		}
+	}
+}
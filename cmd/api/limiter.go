@@ -0,0 +1,66 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// keyedLimiter limits how often something can be done for a given key,
+// such as an email address, where the rateLimit middleware can only tell
+// clients apart by IP address.
+type keyedLimiter struct {
+	mu      sync.Mutex
+	limit   rate.Limit
+	burst   int
+	entries map[string]*keyedLimiterEntry
+}
+
+type keyedLimiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// newKeyedLimiter allows burst events per key, refilled at one every
+// interval. Keys unseen for long enough to have refilled are forgotten.
+func newKeyedLimiter(interval time.Duration, burst int) *keyedLimiter {
+	l := &keyedLimiter{
+		limit:   rate.Every(interval),
+		burst:   burst,
+		entries: make(map[string]*keyedLimiterEntry),
+	}
+
+	idle := interval * time.Duration(burst)
+
+	go func() {
+		for {
+			time.Sleep(time.Minute)
+			l.mu.Lock()
+
+			for key, entry := range l.entries {
+				if time.Since(entry.lastSeen) > idle {
+					delete(l.entries, key)
+				}
+			}
+			l.mu.Unlock()
+		}
+	}()
+
+	return l
+}
+
+func (l *keyedLimiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, found := l.entries[key]
+	if !found {
+		entry = &keyedLimiterEntry{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.entries[key] = entry
+	}
+
+	entry.lastSeen = time.Now()
+
+	return entry.limiter.Allow()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"github.com/thats-insane/comments/internal/data"
+)
+
+// recordMentions saves the users @mentioned in the comment's content and
+// notifies them if the comment is already published.
+func (a *appDependencies) recordMentions(comment *data.Comment) error {
+	err := a.mentionModel.Set(comment, data.ParseMentions(comment.Content))
+	if err != nil {
+		return err
+	}
+
+	a.notifyMentions(comment)
+
+	return nil
+}
+
+// notifyMentions emails the users mentioned in a published comment who
+// have not yet been told about it. Comments held for moderation notify no
+// one until they are approved.
+func (a *appDependencies) notifyMentions(comment *data.Comment) {
+	if comment.Status != data.CommentApproved {
+		return
+	}
+
+	a.background(func() {
+		thread, err := a.threadModel.Get(comment.ThreadID)
+		if err != nil {
+			a.logger.Error(err.Error())
+			return
+		}
+
+		err = a.mentionModel.Notify(comment.ID, "comment_mention.tmpl", func(user *data.User) map[string]any {
+			return map[string]any{
+				"username":  user.Username,
+				"author":    comment.Author,
+				"content":   comment.Content,
+				"commentID": comment.ID,
+				"threadKey": thread.Key,
+			}
+		})
+		if err != nil {
+			a.logger.Error(err.Error())
+		}
+	})
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMentions(t *testing.T) {
+	app := newTestApplication(t)
+
+	alice, aliceToken := app.newTestUser(t, "alice", "comments:read", "comments:write")
+	bob, _ := app.newTestUser(t, "Bob")
+
+	created := app.createTestComment(t, aliceToken, `{"thread_key": "mentions", "content": "thanks @bob, @ALICE and @nobody"}`)
+
+	rows, err := app.mentionModel.DB.Query(`SELECT user_id FROM comment_mentions WHERE comment_id = $1 ORDER BY user_id`, created.Comment.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer rows.Close()
+
+	var mentioned []int64
+
+	for rows.Next() {
+		var id int64
+
+		err = rows.Scan(&id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		mentioned = append(mentioned, id)
+	}
+
+	if rows.Err() != nil {
+		t.Fatal(rows.Err())
+	}
+
+	// Names match regardless of case, and the author never mentions
+	// themselves.
+	if !slices.Equal(mentioned, []int64{bob.ID}) {
+		t.Errorf("got mentions of users %v; want only bob (%d), not alice (%d)", mentioned, bob.ID, alice.ID)
+	}
+
+	// The email is queued in the background, together with marking the
+	// mention as notified.
+	app.wg.Wait()
+
+	emailData := app.lastEmailData(t, bob.Email, "comment_mention.tmpl")
+	if emailData["commentID"] != float64(created.Comment.ID) {
+		t.Errorf("got mention email data %v; want it for comment %d", emailData, created.Comment.ID)
+	}
+}
@@ -102,7 +102,7 @@ func (a *appDependencies) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		user, err := a.userModel.GetForToken(data.ScopeActivation, token)
+		user, err := a.userModel.GetForToken(data.ScopeAuthentication, token)
 		if err != nil {
 			switch {
 			case errors.Is(err, data.ErrRecordNotFound):
@@ -113,6 +113,11 @@ func (a *appDependencies) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
+		if user.Disabled {
+			a.accountDisabledResponse(w, r)
+			return
+		}
+
 		r = a.contextSetUser(r, user)
 		next.ServeHTTP(w, r)
 	})
@@ -173,9 +178,10 @@ func (a *appDependencies) enableCORS(next http.Handler) http.Handler {
 			for i := range a.config.cors.trustedOrigins {
 				if origin == a.config.cors.trustedOrigins[i] {
 					w.Header().Set("Access-Control-Allow-Origin", origin)
+					w.Header().Set("Access-Control-Expose-Headers", "ETag, Location")
 					if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
 						w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match, If-None-Match, X-Expected-Version")
 					}
 					w.WriteHeader(http.StatusOK)
 
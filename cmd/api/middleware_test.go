@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRequirePermission(t *testing.T) {
+	app := newTestApplication(t)
+
+	reader, readerToken := app.newTestUser(t, "reader", "comments:read")
+	_, noneToken := app.newTestUser(t, "nobody")
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+	}{
+		{"anonymous", "", http.StatusUnauthorized},
+		{"without the permission", noneToken, http.StatusForbidden},
+		{"with the permission", readerToken, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := app.do(t, http.MethodGet, "/v1/comments", tt.token, "")
+			res.expectStatus(t, tt.status)
+		})
+	}
+
+	// Granting a permission again is a no-op rather than a second grant.
+	err := app.permsModel.Add(reader.ID, "comments:read", "comments:read")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	perms, err := app.permsModel.GetAll(reader.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(perms) != 1 || perms[0] != "comments:read" {
+		t.Errorf("got permissions %v; want only comments:read", perms)
+	}
+
+	codes, err := app.permsModel.Codes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if seen[code] {
+			t.Errorf("permission %q exists more than once", code)
+		}
+		seen[code] = true
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/thats-insane/comments/migrations"
+)
+
+var migrateCommands = []string{"up", "down", "version", "force"}
+
+// migrateDB runs a migrate command against the database using the
+// migrations embedded in the binary: up, down N, version or force V, where
+// N is the number of migrations to roll back and V the version to record
+// as applied after fixing a failed migration by hand.
+func migrateDB(db *sql.DB, command string, args []string, logger *slog.Logger) error {
+	ctx := context.Background()
+
+	// Use a connection of our own so that closing the migrator does not
+	// close the pool.
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	driver, err := postgres.WithConnection(ctx, conn, &postgres.Config{})
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	source, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		driver.Close()
+		return err
+	}
+
+	m, err := migrate.NewWithInstance("iofs", source, "postgres", driver)
+	if err != nil {
+		source.Close()
+		driver.Close()
+		return err
+	}
+
+	defer m.Close()
+
+	switch command {
+	case "up":
+		err = m.Up()
+	case "down":
+		var n int
+		n, err = migrateArg(command, args)
+		if err == nil {
+			err = m.Steps(-n)
+		}
+	case "force":
+		var version int
+		version, err = migrateArg(command, args)
+		if err == nil {
+			err = m.Force(version)
+		}
+	case "version":
+	default:
+		err = fmt.Errorf("unknown migrate command %q", command)
+	}
+
+	if err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+
+	version, dirty, err := m.Version()
+	if err != nil {
+		if errors.Is(err, migrate.ErrNilVersion) {
+			logger.Info("no migrations applied")
+			return nil
+		}
+		return err
+	}
+
+	logger.Info("database schema", "version", version, "dirty", dirty)
+
+	return nil
+}
+
+func migrateArg(command string, args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("migrate %s takes exactly one argument", command)
+	}
+
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 0 || (command == "down" && n == 0) {
+		return 0, fmt.Errorf("invalid argument %q to migrate %s", args[0], command)
+	}
+
+	return n, nil
+}
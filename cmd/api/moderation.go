@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/thats-insane/comments/internal/data"
+	"github.com/thats-insane/comments/internal/validator"
+)
+
+func (a *appDependencies) listModerationQueueHandler(w http.ResponseWriter, r *http.Request) {
+	queryParameters := r.URL.Query()
+
+	v := validator.New()
+
+	filters := a.readCommentFilters(queryParameters, v)
+
+	data.ValidateFilters(v, filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	comments, metadata, err := a.commentModel.GetPending(filters)
+
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	err = a.decorateComments(r, comments...)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"comments": comments,
+		"metadata": metadata,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) approveCommentHandler(w http.ResponseWriter, r *http.Request) {
+	a.moderateComment(w, r, data.CommentApproved)
+}
+
+func (a *appDependencies) rejectCommentHandler(w http.ResponseWriter, r *http.Request) {
+	a.moderateComment(w, r, data.CommentRejected)
+}
+
+// moderateComment decides on the pending comment named in the URL, recording
+// the moderator's reason, which is required for rejections. A comment that
+// has already been decided on is left alone, so that the classifier is not
+// trained on it and its subscribers are not notified twice.
+func (a *appDependencies) moderateComment(w http.ResponseWriter, r *http.Request, status string) {
+	id, err := a.readIDParam(r)
+
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var incomingData struct {
+		Reason *string `json:"reason"`
+	}
+
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if status == data.CommentRejected {
+		v.Check(incomingData.Reason != nil && *incomingData.Reason != "", "reason", "must be provided")
+	}
+
+	if incomingData.Reason != nil {
+		v.Check(len(*incomingData.Reason) <= 500, "reason", "must not be more than 500 bytes long")
+	}
+
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	comment, err := a.commentModel.Get(id)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+
+		return
+	}
+
+	if comment.Status != data.CommentPending {
+		a.notPendingResponse(w, r)
+		return
+	}
+
+	user := a.contextGetUser(r)
+
+	err = a.commentModel.Moderate(id, data.CommentPending, status, incomingData.Reason, user.ID)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.notPendingResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+
+		return
+	}
+
+	comment, err = a.commentModel.Get(id)
+
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	a.classifier.Train(comment.Content, status == data.CommentRejected)
+	a.notifyMentions(comment)
+	a.notifySubscribers(comment)
+
+	err = a.decorateComments(r, comment)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"comment": comment,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// updateThreadHandler sets the moderation mode of a thread, creating the
+// thread if need be so that it can be configured before its first comment.
+// An empty mode reverts the thread to the server default.
+func (a *appDependencies) updateThreadHandler(w http.ResponseWriter, r *http.Request) {
+	threadKey := a.readThreadKeyParam(r, "key")
+
+	var incomingData struct {
+		Moderation *string `json:"moderation"`
+	}
+
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidateThreadKey(v, threadKey)
+
+	if incomingData.Moderation != nil && *incomingData.Moderation != "" {
+		data.ValidateModerationMode(v, "moderation", *incomingData.Moderation)
+	}
+
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	thread, err := a.threadModel.GetOrCreate(threadKey)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	if incomingData.Moderation != nil {
+		thread.Moderation = incomingData.Moderation
+		if *incomingData.Moderation == "" {
+			thread.Moderation = nil
+		}
+	}
+
+	err = a.threadModel.Update(thread)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"thread": thread,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// initialCommentStatus decides whether a new comment by the user goes live
+// straight away or waits in the moderation queue, following the moderation
+// mode of its thread or, when the thread has none, the server default.
+func (a *appDependencies) initialCommentStatus(user *data.User, thread *data.Thread) (string, error) {
+	mode := a.config.moderation.mode
+	if thread.Moderation != nil {
+		mode = *thread.Moderation
+	}
+
+	switch mode {
+	case data.ModerationAll:
+		return data.CommentPending, nil
+	case data.ModerationFirstTime:
+		approved, err := a.commentModel.HasApproved(user.ID)
+		if err != nil {
+			return "", err
+		}
+
+		if !approved {
+			return data.CommentPending, nil
+		}
+	}
+
+	return data.CommentApproved, nil
+}
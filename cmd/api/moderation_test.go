@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/thats-insane/comments/internal/data"
+)
+
+func TestModerateComment(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.moderation.mode = data.ModerationAll
+
+	_, aliceToken := app.newTestUser(t, "alice", "comments:read", "comments:write")
+	_, bobToken := app.newTestUser(t, "bob", "comments:read")
+	_, modToken := app.newTestUser(t, "mod", "comments:read", "comments:moderate")
+
+	first := app.createTestComment(t, aliceToken, `{"thread_key": "moderation", "content": "first"}`)
+	second := app.createTestComment(t, aliceToken, `{"thread_key": "moderation", "content": "second"}`)
+
+	if first.Comment.Status != data.CommentPending {
+		t.Fatalf("got status %q; want pending", first.Comment.Status)
+	}
+
+	firstPath := fmt.Sprintf("/v1/comments/%d", first.Comment.ID)
+
+	res := app.do(t, http.MethodGet, firstPath, bobToken, "")
+	res.expectStatus(t, http.StatusNotFound)
+
+	res = app.do(t, http.MethodGet, firstPath, aliceToken, "")
+	res.expectStatus(t, http.StatusOK)
+
+	res = app.do(t, http.MethodGet, "/v1/moderation/queue", modToken, "")
+	res.expectStatus(t, http.StatusOK)
+
+	var queue struct {
+		Comments []struct {
+			ID int64 `json:"id"`
+		} `json:"comments"`
+	}
+	res.decode(t, &queue)
+
+	if len(queue.Comments) != 2 {
+		t.Fatalf("got %d comments in the queue; want 2", len(queue.Comments))
+	}
+
+	approve := fmt.Sprintf("/v1/moderation/comments/%d/approve", first.Comment.ID)
+	reject := fmt.Sprintf("/v1/moderation/comments/%d/reject", first.Comment.ID)
+
+	res = app.do(t, http.MethodPost, approve, bobToken, `{}`)
+	res.expectStatus(t, http.StatusForbidden)
+
+	res = app.do(t, http.MethodPost, approve, modToken, `{}`)
+	res.expectStatus(t, http.StatusOK)
+
+	var approved commentResponse
+	res.decode(t, &approved)
+
+	if approved.Comment.Status != data.CommentApproved || approved.Comment.Version != first.Comment.Version {
+		t.Errorf("got status %q at version %d; want approved at version %d", approved.Comment.Status, approved.Comment.Version, first.Comment.Version)
+	}
+
+	// A decision is only acted on once.
+	res = app.do(t, http.MethodPost, approve, modToken, `{}`)
+	res.expectStatus(t, http.StatusConflict)
+
+	res = app.do(t, http.MethodPost, reject, modToken, `{"reason": "too late"}`)
+	res.expectStatus(t, http.StatusConflict)
+
+	res = app.do(t, http.MethodGet, firstPath, bobToken, "")
+	res.expectStatus(t, http.StatusOK)
+
+	reject = fmt.Sprintf("/v1/moderation/comments/%d/reject", second.Comment.ID)
+
+	res = app.do(t, http.MethodPost, reject, modToken, `{}`)
+	res.expectStatus(t, http.StatusUnprocessableEntity)
+
+	res = app.do(t, http.MethodPost, reject, modToken, `{"reason": "off topic"}`)
+	res.expectStatus(t, http.StatusOK)
+
+	res = app.do(t, http.MethodPost, "/v1/moderation/comments/9999/approve", modToken, `{}`)
+	res.expectStatus(t, http.StatusNotFound)
+
+	res = app.do(t, http.MethodGet, "/v1/moderation/queue", modToken, "")
+	res.expectStatus(t, http.StatusOK)
+
+	res.decode(t, &queue)
+	if len(queue.Comments) != 0 {
+		t.Errorf("got %d comments in the queue; want none", len(queue.Comments))
+	}
+}
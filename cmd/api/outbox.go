@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/thats-insane/comments/internal/data"
+	"github.com/thats-insane/comments/internal/validator"
+)
+
+const (
+	outboxBaseBackoff = 30 * time.Second
+	outboxMaxBackoff  = 6 * time.Hour
+
+	// outboxDataRetention is how long dead emails keep their data. It
+	// matches the longest-lived token sent by email, activation, after
+	// which there is nothing useful left to retry.
+	outboxDataRetention = 3 * 24 * time.Hour
+	outboxScrubInterval = time.Hour
+)
+
+// drainOutbox polls the outbox for emails that are due and hands them to a
+// pool of workers to send. Dead emails past outboxDataRetention are
+// scrubbed along the way.
+func (a *appDependencies) drainOutbox() {
+	jobs := make(chan *data.Email)
+
+	for i := 0; i < a.config.outbox.workers; i++ {
+		go a.outboxWorker(jobs)
+	}
+
+	ticker := time.NewTicker(a.config.outbox.pollInterval)
+	defer ticker.Stop()
+
+	scrubTicker := time.NewTicker(outboxScrubInterval)
+	defer scrubTicker.Stop()
+
+	batchSize := 2 * a.config.outbox.workers
+
+	for {
+		select {
+		case <-scrubTicker.C:
+			_, err := a.outboxModel.ScrubDead(outboxDataRetention)
+			if err != nil {
+				a.logger.Error(err.Error())
+			}
+			continue
+		case <-ticker.C:
+		}
+
+		// Keep claiming until the backlog is cleared rather than waiting a
+		// whole interval between batches.
+		for {
+			emails, err := a.outboxModel.Claim(batchSize)
+			if err != nil {
+				a.logger.Error(err.Error())
+				break
+			}
+
+			for _, email := range emails {
+				jobs <- email
+			}
+
+			if len(emails) < batchSize {
+				break
+			}
+		}
+	}
+}
+
+func (a *appDependencies) outboxWorker(jobs <-chan *data.Email) {
+	for email := range jobs {
+		sendErr := a.mailer.Send(email.Recipient, email.Locale, email.Template, email.Data)
+
+		var err error
+		if sendErr == nil {
+			err = a.outboxModel.MarkSent(email.ID)
+		} else {
+			var nextAttempt *time.Time
+			if email.Attempts < a.config.outbox.maxAttempts {
+				next := time.Now().Add(outboxBackoff(email.Attempts))
+				nextAttempt = &next
+			}
+
+			a.logger.Error("sending email failed", "id", email.ID, "attempts", email.Attempts, "dead", nextAttempt == nil, "error", sendErr.Error())
+
+			err = a.outboxModel.MarkFailed(email.ID, sendErr, nextAttempt)
+		}
+
+		if err != nil {
+			a.logger.Error(err.Error())
+		}
+	}
+}
+
+// outboxBackoff returns how long to wait before the next attempt at an
+// email that has failed attempts times, doubling each time.
+func outboxBackoff(attempts int) time.Duration {
+	backoff := outboxBaseBackoff
+	for i := 1; i < attempts && backoff < outboxMaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	return min(backoff, outboxMaxBackoff)
+}
+
+func (a *appDependencies) listEmailsHandler(w http.ResponseWriter, r *http.Request) {
+	var filters data.Filters
+
+	queryParameters := r.URL.Query()
+
+	v := validator.New()
+
+	status := a.getSingleQueryParameters(queryParameters, "status", "")
+	filters.Page = a.getSingleIntegerParameters(queryParameters, "page", 1, v)
+	filters.PageSize = a.getSingleIntegerParameters(queryParameters, "page_size", 20, v)
+
+	data.ValidateEmailStatus(v, status)
+	data.ValidateFilters(v, filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	emails, metadata, err := a.outboxModel.GetAll(status, filters)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"emails":   emails,
+		"metadata": metadata,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) displayEmailHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	email, err := a.outboxModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"email": email,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// retryEmailHandler puts a dead-lettered email back in the queue.
+func (a *appDependencies) retryEmailHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	email, err := a.outboxModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	err = a.outboxModel.Retry(email.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEmailNotDead):
+			a.emailNotDeadResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	email, err = a.outboxModel.Get(email.ID)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"email": email,
+	}
+
+	err = a.writeJSON(w, http.StatusAccepted, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/thats-insane/comments/internal/data"
+	"github.com/thats-insane/comments/internal/validator"
+)
+
+func (a *appDependencies) addReactionHandler(w http.ResponseWriter, r *http.Request) {
+	a.changeReaction(w, r, a.reactionModel.Add)
+}
+
+func (a *appDependencies) removeReactionHandler(w http.ResponseWriter, r *http.Request) {
+	a.changeReaction(w, r, a.reactionModel.Remove)
+}
+
+// changeReaction applies change to the requesting user's reaction of the kind
+// named in the URL, then responds with the comment and its updated counts.
+func (a *appDependencies) changeReaction(w http.ResponseWriter, r *http.Request, change func(commentID int64, userID int64, kind string) error) {
+	id, err := a.readIDParam(r)
+
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	kind := httprouter.ParamsFromContext(r.Context()).ByName("kind")
+
+	v := validator.New()
+
+	data.ValidateReactionKind(v, kind)
+
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	comment, err := a.commentModel.Get(id)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+
+		return
+	}
+
+	user := a.contextGetUser(r)
+
+	visible, err := a.canViewComment(user, comment)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	if !visible {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	err = change(comment.ID, user.ID, kind)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+
+		return
+	}
+
+	comment, err = a.commentModel.Get(comment.ID)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	err = a.decorateComments(r, comment)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"comment": comment,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestReactions(t *testing.T) {
+	app := newTestApplication(t)
+
+	_, aliceToken := app.newTestUser(t, "alice", "comments:read", "comments:write")
+	_, bobToken := app.newTestUser(t, "bob", "comments:read")
+
+	created := app.createTestComment(t, aliceToken, `{"thread_key": "reactions", "content": "vote on me"}`)
+	path := fmt.Sprintf("/v1/comments/%d", created.Comment.ID)
+
+	res := app.do(t, http.MethodGet, path, bobToken, "")
+	res.expectStatus(t, http.StatusOK)
+
+	etag := res.header.Get("ETag")
+
+	react := func(method string, kind string) commentResponse {
+		t.Helper()
+
+		res := app.do(t, method, path+"/reactions/"+kind, bobToken, "")
+		res.expectStatus(t, http.StatusOK)
+
+		var reacted commentResponse
+		res.decode(t, &reacted)
+
+		return reacted
+	}
+
+	tests := []struct {
+		method string
+		kind   string
+		score  int
+		mine   []string
+	}{
+		{http.MethodPost, "upvote", 1, []string{"upvote"}},
+		{http.MethodPost, "upvote", 1, []string{"upvote"}},
+		{http.MethodPost, "like", 1, []string{"like", "upvote"}},
+		{http.MethodPost, "downvote", -1, []string{"downvote", "like"}},
+		{http.MethodDelete, "downvote", 0, []string{"like"}},
+	}
+
+	for _, tt := range tests {
+		reacted := react(tt.method, tt.kind)
+
+		if reacted.Comment.Score != tt.score || !slices.Equal(reacted.Comment.MyReactions, tt.mine) {
+			t.Errorf("after %s %s: got score %d and reactions %v; want %d and %v", tt.method, tt.kind,
+				reacted.Comment.Score, reacted.Comment.MyReactions, tt.score, tt.mine)
+		}
+	}
+
+	res = app.do(t, http.MethodDelete, path+"/reactions/upvote", bobToken, "")
+	res.expectStatus(t, http.StatusNotFound)
+
+	res = app.do(t, http.MethodPost, path+"/reactions/heart", bobToken, "")
+	res.expectStatus(t, http.StatusUnprocessableEntity)
+
+	res = app.do(t, http.MethodGet, path, aliceToken, "", "If-None-Match", etag)
+	res.expectStatus(t, http.StatusOK)
+
+	var seen commentResponse
+	res.decode(t, &seen)
+
+	if seen.Comment.Reactions["like"] != 1 || len(seen.Comment.MyReactions) != 0 {
+		t.Errorf("alice sees reactions %v and her own %v; want one like, none hers", seen.Comment.Reactions, seen.Comment.MyReactions)
+	}
+
+	// Reactions change the representation but are not edits, so they must
+	// not get in the way of an edit based on the version read before them.
+	if seen.Comment.Version != created.Comment.Version {
+		t.Fatalf("reactions moved the version from %d to %d", created.Comment.Version, seen.Comment.Version)
+	}
+
+	res = app.do(t, http.MethodPatch, path, aliceToken, `{"content": "edited"}`, "X-Expected-Version", fmt.Sprint(created.Comment.Version))
+	res.expectStatus(t, http.StatusOK)
+
+	res = app.do(t, http.MethodGet, path+"/revisions?diff=1,2", aliceToken, "")
+	res.expectStatus(t, http.StatusOK)
+}
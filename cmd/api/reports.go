@@ -0,0 +1,266 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/thats-insane/comments/internal/data"
+	"github.com/thats-insane/comments/internal/validator"
+)
+
+func (a *appDependencies) createReportHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var incomingData struct {
+		Reason string `json:"reason"`
+		Note   string `json:"note"`
+	}
+
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	comment, err := a.commentModel.Get(id)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+
+		return
+	}
+
+	user := a.contextGetUser(r)
+
+	visible, err := a.canViewComment(user, comment)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	if !visible {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	report := &data.Report{
+		CommentID: comment.ID,
+		UserID:    user.ID,
+		Reason:    incomingData.Reason,
+		Note:      incomingData.Note,
+	}
+
+	v := validator.New()
+
+	data.ValidateReport(v, report)
+	v.Check(comment.UserID == nil || *comment.UserID != user.ID, "comment", "you cannot report your own comment")
+
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.reportModel.Insert(report)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateReport):
+			v.AddError("comment", "you have already reported this comment")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	// Once enough readers object, the comment is taken down until a
+	// moderator has looked at it.
+	if a.config.reports.threshold > 0 && comment.Status == data.CommentApproved {
+		count, err := a.reportModel.CountOpen(comment.ID)
+		if err != nil {
+			a.serverErrResponse(w, r, err)
+			return
+		}
+
+		if count >= a.config.reports.threshold {
+			err = a.commentModel.Hide(comment.ID, fmt.Sprintf("hidden automatically after %d reports", count), true)
+			if err != nil {
+				a.serverErrResponse(w, r, err)
+				return
+			}
+		}
+	}
+
+	data := envelope{
+		"report": report,
+	}
+
+	err = a.writeJSON(w, http.StatusCreated, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) listReportsHandler(w http.ResponseWriter, r *http.Request) {
+	var filters data.Filters
+
+	queryParameters := r.URL.Query()
+
+	v := validator.New()
+
+	filters.Page = a.getSingleIntegerParameters(queryParameters, "page", 1, v)
+	filters.PageSize = a.getSingleIntegerParameters(queryParameters, "page_size", 10, v)
+
+	data.ValidateFilters(v, filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	groups, metadata, err := a.reportModel.GetOpen(filters)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	comments := make([]*data.Comment, 0, len(groups))
+	for _, group := range groups {
+		comments = append(comments, group.Comment)
+	}
+
+	err = a.decorateComments(r, comments...)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"reports":  groups,
+		"metadata": metadata,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// resolveReportsHandler upholds the open reports against a comment, which
+// rejects the comment.
+func (a *appDependencies) resolveReportsHandler(w http.ResponseWriter, r *http.Request) {
+	a.closeReports(w, r, data.ReportResolved)
+}
+
+// dismissReportsHandler rejects the open reports against a comment, which
+// puts the comment back on display if the reports had hidden it.
+func (a *appDependencies) dismissReportsHandler(w http.ResponseWriter, r *http.Request) {
+	a.closeReports(w, r, data.ReportDismissed)
+}
+
+func (a *appDependencies) closeReports(w http.ResponseWriter, r *http.Request, reportStatus string) {
+	id, err := a.readIDParam(r)
+
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	var incomingData struct {
+		Reason *string `json:"reason"`
+	}
+
+	err = a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if incomingData.Reason != nil {
+		v.Check(len(*incomingData.Reason) <= 500, "reason", "must not be more than 500 bytes long")
+	}
+
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := a.contextGetUser(r)
+
+	closed, err := a.reportModel.Close(id, reportStatus, user.ID)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	if closed == 0 {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	comment, err := a.commentModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	switch reportStatus {
+	case data.ReportResolved:
+		if comment.Status != data.CommentRejected {
+			err = a.commentModel.Moderate(comment.ID, comment.Status, data.CommentRejected, incomingData.Reason, user.ID)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrEditConflict):
+					a.editConflictResponse(w, r)
+				default:
+					a.serverErrResponse(w, r, err)
+				}
+				return
+			}
+
+			a.classifier.Train(comment.Content, true)
+		}
+	case data.ReportDismissed:
+		// Only a comment the reports themselves hid is put back; one held by
+		// pre-moderation or the content filter, or rejected by a moderator,
+		// keeps its status.
+		restored, err := a.commentModel.Unhide(comment.ID)
+		if err != nil {
+			a.serverErrResponse(w, r, err)
+			return
+		}
+
+		if restored {
+			comment.Status = data.CommentApproved
+
+			a.classifier.Train(comment.Content, false)
+			a.notifyMentions(comment)
+			a.notifySubscribers(comment)
+		}
+	}
+
+	data := envelope{
+		"message": fmt.Sprintf("%d report(s) %s", closed, reportStatus),
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/thats-insane/comments/internal/data"
+)
+
+func TestReportsHideAndDismiss(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.reports.threshold = 2
+
+	_, aliceToken := app.newTestUser(t, "alice", "comments:read", "comments:write")
+	_, bobToken := app.newTestUser(t, "bob", "comments:read")
+	_, carolToken := app.newTestUser(t, "carol", "comments:read")
+	_, modToken := app.newTestUser(t, "mod", "comments:read", "comments:moderate")
+
+	created := app.createTestComment(t, aliceToken, `{"thread_key": "reports", "content": "contested"}`)
+	path := fmt.Sprintf("/v1/comments/%d", created.Comment.ID)
+
+	res := app.do(t, http.MethodPost, path+"/reports", aliceToken, `{"reason": "spam"}`)
+	res.expectStatus(t, http.StatusUnprocessableEntity)
+
+	res = app.do(t, http.MethodPost, path+"/reports", bobToken, `{"reason": "spam"}`)
+	res.expectStatus(t, http.StatusCreated)
+
+	res = app.do(t, http.MethodPost, path+"/reports", bobToken, `{"reason": "spam"}`)
+	res.expectStatus(t, http.StatusUnprocessableEntity)
+
+	res = app.do(t, http.MethodGet, path, carolToken, "")
+	res.expectStatus(t, http.StatusOK)
+
+	etag := res.header.Get("ETag")
+
+	res = app.do(t, http.MethodPost, path+"/reports", carolToken, `{"reason": "off_topic"}`)
+	res.expectStatus(t, http.StatusCreated)
+
+	res = app.do(t, http.MethodGet, path, carolToken, "")
+	res.expectStatus(t, http.StatusNotFound)
+
+	res = app.do(t, http.MethodPost, fmt.Sprintf("/v1/moderation/comments/%d/reports/dismiss", created.Comment.ID), modToken, `{}`)
+	res.expectStatus(t, http.StatusOK)
+
+	// Back on display, but as a new representation of the comment.
+	res = app.do(t, http.MethodGet, path, carolToken, "", "If-None-Match", etag)
+	res.expectStatus(t, http.StatusOK)
+
+	var restored commentResponse
+	res.decode(t, &restored)
+
+	if restored.Comment.Status != data.CommentApproved || restored.Comment.Version != created.Comment.Version {
+		t.Errorf("got status %q at version %d; want approved at version %d", restored.Comment.Status, restored.Comment.Version, created.Comment.Version)
+	}
+
+	res = app.do(t, http.MethodPost, fmt.Sprintf("/v1/moderation/comments/%d/reports/dismiss", created.Comment.ID), modToken, `{}`)
+	res.expectStatus(t, http.StatusNotFound)
+}
+
+func TestDismissingReportsKeepsHeldComments(t *testing.T) {
+	app := newTestApplication(t)
+	app.config.moderation.mode = data.ModerationAll
+
+	_, aliceToken := app.newTestUser(t, "alice", "comments:read", "comments:write")
+	_, modToken := app.newTestUser(t, "mod", "comments:read", "comments:moderate")
+
+	created := app.createTestComment(t, aliceToken, `{"thread_key": "reports", "content": "held"}`)
+
+	res := app.do(t, http.MethodPost, fmt.Sprintf("/v1/comments/%d/reports", created.Comment.ID), modToken, `{"reason": "other"}`)
+	res.expectStatus(t, http.StatusCreated)
+
+	res = app.do(t, http.MethodPost, fmt.Sprintf("/v1/moderation/comments/%d/reports/dismiss", created.Comment.ID), modToken, `{}`)
+	res.expectStatus(t, http.StatusOK)
+
+	comment, err := app.commentModel.Get(created.Comment.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if comment.Status != data.CommentPending {
+		t.Errorf("dismissing the reports took the comment from pending to %q", comment.Status)
+	}
+}
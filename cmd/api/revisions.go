@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/thats-insane/comments/internal/data"
+	"github.com/thats-insane/comments/internal/diff"
+	"github.com/thats-insane/comments/internal/validator"
+)
+
+func (a *appDependencies) listRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	comment, err := a.commentModel.Get(id)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+
+		return
+	}
+
+	allowed, err := a.canModifyComment(a.contextGetUser(r), comment)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	if !allowed {
+		a.notPermittedResponse(w, r)
+		return
+	}
+
+	queryParameters := r.URL.Query()
+
+	if queryParameters.Has("diff") {
+		a.diffRevisions(w, r, comment)
+		return
+	}
+
+	var filters data.Filters
+
+	v := validator.New()
+
+	filters.Page = a.getSingleIntegerParameters(queryParameters, "page", 1, v)
+	filters.PageSize = a.getSingleIntegerParameters(queryParameters, "page_size", 10, v)
+
+	data.ValidateFilters(v, filters)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	revisions, err := a.revisionModel.GetAll(comment.ID, filters)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"revisions": revisions,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// diffRevisions responds with the changes between the two versions named in
+// ?diff=from,to, compared by word or, with ?diff_by=line, by line.
+func (a *appDependencies) diffRevisions(w http.ResponseWriter, r *http.Request, comment *data.Comment) {
+	queryParameters := r.URL.Query()
+
+	v := validator.New()
+
+	versions := a.getMultipleQueryParameters(queryParameters, "diff", []string{})
+	diffBy := a.getSingleQueryParameters(queryParameters, "diff_by", "word")
+
+	v.Check(len(versions) == 2, "diff", "must be two comma-separated versions")
+	v.Check(diffBy == "word" || diffBy == "line", "diff_by", "must be either word or line")
+
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	contents := make([]string, 2)
+	numbers := make([]int32, 2)
+
+	for i, version := range versions {
+		number, err := strconv.ParseInt(version, 10, 32)
+		if err != nil || number < 1 || number > int64(comment.Version) {
+			v.AddError("diff", "must reference existing versions of the comment")
+			a.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		numbers[i] = int32(number)
+
+		if numbers[i] == comment.Version {
+			contents[i] = comment.Content
+			continue
+		}
+
+		revision, err := a.revisionModel.Get(comment.ID, numbers[i])
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				v.AddError("diff", "must reference existing versions of the comment")
+				a.failedValidationResponse(w, r, v.Errors)
+			default:
+				a.serverErrResponse(w, r, err)
+			}
+			return
+		}
+
+		contents[i] = revision.Content
+	}
+
+	var changes []diff.Change
+	switch diffBy {
+	case "line":
+		changes = diff.Lines(contents[0], contents[1])
+	default:
+		changes = diff.Words(contents[0], contents[1])
+	}
+
+	data := envelope{
+		"diff": map[string]any{
+			"from":    numbers[0],
+			"to":      numbers[1],
+			"changes": changes,
+		},
+	}
+
+	err := a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
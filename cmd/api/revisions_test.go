@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/thats-insane/comments/internal/diff"
+)
+
+func TestRevisions(t *testing.T) {
+	app := newTestApplication(t)
+
+	_, aliceToken := app.newTestUser(t, "alice", "comments:read", "comments:write")
+	_, bobToken := app.newTestUser(t, "bob", "comments:read")
+
+	created := app.createTestComment(t, aliceToken, `{"thread_key": "revisions", "content": "a quick fox"}`)
+	path := fmt.Sprintf("/v1/comments/%d", created.Comment.ID)
+
+	for _, content := range []string{"a slow fox", "a slow brown fox"} {
+		res := app.do(t, http.MethodPatch, path, aliceToken, fmt.Sprintf(`{"content": %q}`, content))
+		res.expectStatus(t, http.StatusOK)
+
+		// Reactions in between edits must not shift the version numbers the
+		// revisions are recorded under.
+		res = app.do(t, http.MethodPost, path+"/reactions/upvote", bobToken, "")
+		res.expectStatus(t, http.StatusOK)
+
+		res = app.do(t, http.MethodDelete, path+"/reactions/upvote", bobToken, "")
+		res.expectStatus(t, http.StatusOK)
+	}
+
+	res := app.do(t, http.MethodGet, path+"/revisions", bobToken, "")
+	res.expectStatus(t, http.StatusForbidden)
+
+	res = app.do(t, http.MethodGet, path+"/revisions", aliceToken, "")
+	res.expectStatus(t, http.StatusOK)
+
+	var listed struct {
+		Revisions []struct {
+			Version int32  `json:"version"`
+			Content string `json:"content"`
+		} `json:"revisions"`
+	}
+	res.decode(t, &listed)
+
+	if len(listed.Revisions) != 2 ||
+		listed.Revisions[0].Version != 2 || listed.Revisions[0].Content != "a slow fox" ||
+		listed.Revisions[1].Version != 1 || listed.Revisions[1].Content != "a quick fox" {
+		t.Fatalf("got revisions %s; want versions 2 and 1 with their content", res.body)
+	}
+
+	tests := []struct {
+		query string
+		want  []diff.Change
+	}{
+		{
+			query: "diff=1,2",
+			want:  []diff.Change{{Op: diff.OpEqual, Text: "a "}, {Op: diff.OpDelete, Text: "quick"}, {Op: diff.OpInsert, Text: "slow"}, {Op: diff.OpEqual, Text: " fox"}},
+		},
+		{
+			query: "diff=2,3",
+			want:  []diff.Change{{Op: diff.OpEqual, Text: "a slow "}, {Op: diff.OpInsert, Text: "brown "}, {Op: diff.OpEqual, Text: "fox"}},
+		},
+		{
+			query: "diff=1,3&diff_by=line",
+			want:  []diff.Change{{Op: diff.OpDelete, Text: "a quick fox"}, {Op: diff.OpInsert, Text: "a slow brown fox"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			res := app.do(t, http.MethodGet, path+"/revisions?"+tt.query, aliceToken, "")
+			res.expectStatus(t, http.StatusOK)
+
+			var diffed struct {
+				Diff struct {
+					Changes []diff.Change `json:"changes"`
+				} `json:"diff"`
+			}
+			res.decode(t, &diffed)
+
+			if fmt.Sprint(diffed.Diff.Changes) != fmt.Sprint(tt.want) {
+				t.Errorf("got changes %v; want %v", diffed.Diff.Changes, tt.want)
+			}
+		})
+	}
+
+	for _, query := range []string{"diff=1,4", "diff=0,1", "diff=1", "diff=1,2&diff_by=char"} {
+		res = app.do(t, http.MethodGet, path+"/revisions?"+query, aliceToken, "")
+		res.expectStatus(t, http.StatusUnprocessableEntity)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/thats-insane/comments/internal/data"
+	"github.com/thats-insane/comments/internal/validator"
+)
+
+// checkDefaultRole makes sure the role given to new users exists, as
+// registering would otherwise leave them without any permissions.
+func (a *appDependencies) checkDefaultRole() error {
+	roles, err := a.roleModel.GetAll()
+	if err != nil {
+		return err
+	}
+
+	if !slices.ContainsFunc(roles, func(role *data.Role) bool { return role.Code == a.config.defaultRole }) {
+		return fmt.Errorf("default role %q does not exist", a.config.defaultRole)
+	}
+
+	return nil
+}
+
+func (a *appDependencies) listRolesHandler(w http.ResponseWriter, r *http.Request) {
+	roles, err := a.roleModel.GetAll()
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"roles": roles,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) grantRoleHandler(w http.ResponseWriter, r *http.Request) {
+	a.changeUserRole(w, r, a.roleModel.Grant)
+}
+
+func (a *appDependencies) revokeRoleHandler(w http.ResponseWriter, r *http.Request) {
+	a.changeUserRole(w, r, a.roleModel.Revoke)
+}
+
+// changeUserRole applies change to the role named in the URL for the user
+// with the id in the URL.
+func (a *appDependencies) changeUserRole(w http.ResponseWriter, r *http.Request, change func(userID int64, code string) error) {
+	roles, err := a.roleModel.GetAll()
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	codes := []string{}
+	for _, role := range roles {
+		codes = append(codes, role.Code)
+	}
+
+	a.changeUserAccess(w, r, "role", codes, change)
+}
+
+func (a *appDependencies) grantPermissionHandler(w http.ResponseWriter, r *http.Request) {
+	a.changeUserPermission(w, r, func(userID int64, code string) error {
+		return a.permsModel.Add(userID, code)
+	})
+}
+
+func (a *appDependencies) revokePermissionHandler(w http.ResponseWriter, r *http.Request) {
+	a.changeUserPermission(w, r, func(userID int64, code string) error {
+		return a.permsModel.Remove(userID, code)
+	})
+}
+
+// changeUserPermission applies change to the permission named in the URL
+// for the user with the id in the URL. Only directly granted permissions
+// are changed; those that come with a role stay until the role is revoked.
+func (a *appDependencies) changeUserPermission(w http.ResponseWriter, r *http.Request, change func(userID int64, code string) error) {
+	codes, err := a.permsModel.Codes()
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	a.changeUserAccess(w, r, "permission", codes, change)
+}
+
+// changeUserAccess applies change to the role or permission in the URL
+// parameter param, which must be one of codes, and responds with the user's
+// resulting roles and permissions.
+func (a *appDependencies) changeUserAccess(w http.ResponseWriter, r *http.Request, param string, codes []string, change func(userID int64, code string) error) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	code := httprouter.ParamsFromContext(r.Context()).ByName(param)
+
+	v := validator.New()
+
+	v.Check(validator.PermittedValue(code, codes...), param, "must be one of "+strings.Join(codes, ", "))
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := a.userModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	err = change(user.ID, code)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	roles, err := a.roleModel.GetForUser(user.ID)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	perms, err := a.permsModel.GetAll(user.ID)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	if perms == nil {
+		perms = data.Perms{}
+	}
+
+	data := envelope{
+		"roles":       roles,
+		"permissions": perms,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
@@ -15,15 +15,63 @@ func (a *appDependencies) routes() http.Handler {
 
 	router.HandlerFunc(http.MethodGet, "/v1/comments", a.requirePermission("comments:read", a.listCommentsHandler))
 	router.HandlerFunc(http.MethodGet, "/v1/comments/:id", a.requirePermission("comments:read", a.displayCommentHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/comments/:id/replies", a.requirePermission("comments:read", a.listRepliesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/comments/:id/revisions", a.requirePermission("comments:read", a.listRevisionsHandler))
+	// The trash lives under /v1/moderation rather than at /v1/comments/trash,
+	// as httprouter cannot register a static segment alongside /v1/comments/:id.
+	router.HandlerFunc(http.MethodGet, "/v1/moderation/trash", a.requirePermission("comments:moderate", a.listTrashHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/moderation/queue", a.requirePermission("comments:moderate", a.listModerationQueueHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/moderation/reports", a.requirePermission("comments:moderate", a.listReportsHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/emails", a.requirePermission("emails:admin", a.listEmailsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/emails/:id", a.requirePermission("emails:admin", a.displayEmailHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users", a.requirePermission("users:admin", a.listUsersHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id", a.requirePermission("users:admin", a.displayUserHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/roles", a.requirePermission("users:admin", a.listRolesHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me", a.requireAuthentication(a.displayCurrentUserHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/subscriptions", a.requireActivatedUser(a.listSubscriptionsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/subscriptions/unsubscribe", a.showUnsubscribeHandler)
 
 	router.HandlerFunc(http.MethodPatch, "/v1/comments/:id", a.requirePermission("comments:write", a.updateCommentHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/threads", a.requirePermission("comments:moderate", a.updateThreadHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/preferences", a.requireActivatedUser(a.updateUserPreferencesHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me", a.requireActivatedUser(a.updateCurrentUserHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me/email", a.requireActivatedUser(a.requestEmailChangeHandler))
 
 	router.HandlerFunc(http.MethodPost, "/v1/comments", a.requirePermission("comments:write", a.createCommentHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/comments/:id/restore", a.requirePermission("comments:moderate", a.restoreCommentHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/comments/:id/reactions/:kind", a.requireActivatedUser(a.addReactionHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/moderation/comments/:id/approve", a.requirePermission("comments:moderate", a.approveCommentHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/moderation/comments/:id/reject", a.requirePermission("comments:moderate", a.rejectCommentHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/moderation/comments/:id/reports/resolve", a.requirePermission("comments:moderate", a.resolveReportsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/moderation/comments/:id/reports/dismiss", a.requirePermission("comments:moderate", a.dismissReportsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/comments/:id/reports", a.requireActivatedUser(a.createReportHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/emails/:id/retry", a.requirePermission("emails:admin", a.retryEmailHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/deactivate", a.requirePermission("users:admin", a.deactivateUserHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/reactivate", a.requirePermission("users:admin", a.reactivateUserHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/logout", a.requirePermission("users:admin", a.logoutUserHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/subscriptions/unsubscribe", a.oneClickUnsubscribeHandler)
 	router.HandlerFunc(http.MethodPost, "/v1/users", a.registerUserHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", a.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", a.createPasswordResetTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/activation", a.createActivationTokenHandler)
 
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", a.activateUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/password", a.updateUserPasswordHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/email", a.confirmEmailChangeHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/threads/subscription", a.requireActivatedUser(a.subscribeThreadHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/comments/:id/subscription", a.requireActivatedUser(a.subscribeCommentHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/admin/users/:id/roles/:role", a.requirePermission("users:admin", a.grantRoleHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/admin/users/:id/permissions/:permission", a.requirePermission("users:admin", a.grantPermissionHandler))
 
 	router.HandlerFunc(http.MethodDelete, "/v1/comments/:id", a.requirePermission("comments:write", a.deleteCommentHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/comments/:id/reactions/:kind", a.requireActivatedUser(a.removeReactionHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/threads/subscription", a.requireActivatedUser(a.unsubscribeThreadHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/comments/:id/subscription", a.requireActivatedUser(a.unsubscribeCommentHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me", a.requireAuthentication(a.deleteCurrentUserHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id", a.requirePermission("users:admin", a.deleteUserHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/roles/:role", a.requirePermission("users:admin", a.revokeRoleHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/permissions/:permission", a.requirePermission("users:admin", a.revokePermissionHandler))
 
 	return a.recoverPanic(a.enableCORS(a.rateLimit(a.authenticate(router))))
 }
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/thats-insane/comments/internal/data"
+	"github.com/thats-insane/comments/internal/validator"
+)
+
+// unsubscribeLinkTTL is how long the unsubscribe link in a notification
+// email keeps working.
+const unsubscribeLinkTTL = 30 * 24 * time.Hour
+
+func (a *appDependencies) listSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := a.contextGetUser(r)
+
+	subscriptions, err := a.subscriptionModel.GetAllForUser(user.ID)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"subscriptions": subscriptions,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// subscribeThreadHandler subscribes the user to every new comment in the
+// thread, or changes the delivery mode of an existing subscription.
+func (a *appDependencies) subscribeThreadHandler(w http.ResponseWriter, r *http.Request) {
+	thread, err := a.threadModel.GetByKey(a.readThreadKeyParam(r, "key"))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	a.subscribe(w, r, &data.Subscription{ThreadID: &thread.ID})
+}
+
+// subscribeCommentHandler subscribes the user to replies to the comment.
+func (a *appDependencies) subscribeCommentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	comment, err := a.commentModel.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	visible, err := a.canViewComment(a.contextGetUser(r), comment)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	if !visible {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	a.subscribe(w, r, &data.Subscription{CommentID: &comment.ID})
+}
+
+func (a *appDependencies) subscribe(w http.ResponseWriter, r *http.Request, subscription *data.Subscription) {
+	var incomingData struct {
+		Mode string `json:"mode"`
+	}
+
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	subscription.UserID = a.contextGetUser(r).ID
+	subscription.Mode = incomingData.Mode
+	if subscription.Mode == "" {
+		subscription.Mode = data.DeliveryImmediate
+	}
+
+	v := validator.New()
+
+	data.ValidateDeliveryMode(v, subscription.Mode)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.subscriptionModel.Upsert(subscription)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"subscription": subscription,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) unsubscribeThreadHandler(w http.ResponseWriter, r *http.Request) {
+	thread, err := a.threadModel.GetByKey(a.readThreadKeyParam(r, "key"))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	a.unsubscribe(w, r, thread.ID, 0)
+}
+
+func (a *appDependencies) unsubscribeCommentHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := a.readIDParam(r)
+	if err != nil {
+		a.notFoundResponse(w, r)
+		return
+	}
+
+	a.unsubscribe(w, r, 0, id)
+}
+
+func (a *appDependencies) unsubscribe(w http.ResponseWriter, r *http.Request, threadID int64, commentID int64) {
+	user := a.contextGetUser(r)
+
+	err := a.subscriptionModel.Delete(user.ID, threadID, commentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"message": "subscription successfully removed",
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// showUnsubscribeHandler serves the link at the foot of every notification
+// email when it is opened. Mail scanners and link previews fetch such links
+// on their own, so it only checks the link and never unsubscribes.
+func (a *appDependencies) showUnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	_, ok := a.readUnsubscribeLink(r.URL.Query())
+	if !ok {
+		v := validator.New()
+		v.AddError("link", "invalid or expired unsubscribe link")
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	data := envelope{
+		"message": "send a POST request to this URL to unsubscribe from all notifications",
+	}
+
+	err := a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// oneClickUnsubscribeHandler removes all of the user's subscriptions. It
+// needs no authentication beyond the signed link, and is what mail clients
+// POST to for the List-Unsubscribe-Post header (RFC 8058).
+func (a *appDependencies) oneClickUnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := a.readUnsubscribeLink(r.URL.Query())
+	if !ok {
+		v := validator.New()
+		v.AddError("link", "invalid or expired unsubscribe link")
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err := a.subscriptionModel.DeleteAllForUser(userID)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"message": "you have been unsubscribed from all notifications",
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// notifySubscribers tells the users subscribed to a newly published
+// comment's thread, or to the comment it replies to, about it. Those who
+// asked for a digest hear about it in their next one.
+func (a *appDependencies) notifySubscribers(comment *data.Comment) {
+	if comment.Status != data.CommentApproved {
+		return
+	}
+
+	a.background(func() {
+		err := a.notificationModel.Enqueue(comment)
+		if err != nil {
+			a.logger.Error(err.Error())
+			return
+		}
+
+		thread, err := a.threadModel.Get(comment.ThreadID)
+		if err != nil {
+			a.logger.Error(err.Error())
+			return
+		}
+
+		err = a.notificationModel.SendImmediate(comment.ID, "comment_notification.tmpl", func(user *data.User) map[string]any {
+			return map[string]any{
+				"username":       user.Username,
+				"author":         comment.Author,
+				"content":        comment.Content,
+				"commentID":      comment.ID,
+				"isReply":        comment.ParentID != nil,
+				"threadKey":      thread.Key,
+				"unsubscribeURL": a.unsubscribeURL(user.ID),
+			}
+		})
+		if err != nil {
+			a.logger.Error(err.Error())
+		}
+	})
+}
+
+// unsubscribeURL returns a one-click unsubscribe link for the user. The link
+// is signed rather than backed by a token, so sending it stores nothing.
+func (a *appDependencies) unsubscribeURL(userID int64) string {
+	expires := time.Now().Add(unsubscribeLinkTTL).Unix()
+
+	query := url.Values{
+		"user":    {strconv.FormatInt(userID, 10)},
+		"expires": {strconv.FormatInt(expires, 10)},
+		"sig":     {a.unsubscribeSignature(userID, expires)},
+	}
+
+	return fmt.Sprintf("%s/v1/subscriptions/unsubscribe?%s", a.config.baseURL, query.Encode())
+}
+
+// readUnsubscribeLink returns the user named by an unexpired unsubscribe
+// link, and whether its signature is valid.
+func (a *appDependencies) readUnsubscribeLink(query url.Values) (int64, bool) {
+	userID, err := strconv.ParseInt(query.Get("user"), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return 0, false
+	}
+
+	sig := a.unsubscribeSignature(userID, expires)
+
+	return userID, hmac.Equal([]byte(query.Get("sig")), []byte(sig))
+}
+
+func (a *appDependencies) unsubscribeSignature(userID int64, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(a.config.notifications.unsubscribeSecret))
+	fmt.Fprintf(mac, "unsubscribe:%d:%d", userID, expires)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
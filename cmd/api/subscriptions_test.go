@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/thats-insane/comments/internal/data"
+)
+
+func TestDigests(t *testing.T) {
+	app := newTestApplication(t)
+
+	_, aliceToken := app.newTestUser(t, "alice", "comments:read", "comments:write")
+	bob, bobToken := app.newTestUser(t, "bob", "comments:read")
+
+	app.createTestComment(t, aliceToken, `{"thread_key": "digests", "content": "first"}`)
+
+	res := app.do(t, http.MethodPut, "/v1/threads/subscription?key=digests", bobToken, `{"mode": "digest"}`)
+	res.expectStatus(t, http.StatusOK)
+
+	created := app.createTestComment(t, aliceToken, `{"thread_key": "digests", "content": "second"}`)
+
+	// Notifications are queued in the background.
+	app.wg.Wait()
+
+	sendDigests := func() int {
+		t.Helper()
+
+		sent, err := app.notificationModel.SendDigests(time.Hour, "comment_digest.tmpl", func(digest *data.Digest) map[string]any {
+			return map[string]any{"username": digest.User.Username, "items": digest.Items}
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return sent
+	}
+
+	if sent := sendDigests(); sent != 0 {
+		t.Fatalf("sent %d digests; want none before the interval has passed", sent)
+	}
+
+	// Digests are due by the age of what they hold rather than by when the
+	// server last sent any, so a restart does not hold them back.
+	_, err := app.notificationModel.DB.Exec(`UPDATE notifications SET created_at = NOW() - INTERVAL '2 hours'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sent := sendDigests(); sent != 1 {
+		t.Fatalf("sent %d digests; want one for bob", sent)
+	}
+
+	items, _ := app.lastEmailData(t, bob.Email, "comment_digest.tmpl")["items"].([]any)
+	if len(items) != 1 || items[0].(map[string]any)["CommentID"] != float64(created.Comment.ID) {
+		t.Errorf("got digest items %v; want the second comment only", items)
+	}
+
+	if sent := sendDigests(); sent != 0 {
+		t.Errorf("sent %d digests; want none once they have been sent", sent)
+	}
+}
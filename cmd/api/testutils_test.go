@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thats-insane/comments/internal/data"
+	"github.com/thats-insane/comments/internal/mailer"
+)
+
+// testApplication is an application wired to a test database, together with
+// its routes.
+type testApplication struct {
+	*appDependencies
+	handler   http.Handler
+	transport *mailer.MemoryTransport
+}
+
+// newTestApplication returns an application backed by the PostgreSQL
+// database named by COMMENTS_TEST_DB_DSN, migrated and emptied of everything
+// but the seeded permissions and roles. Tests that need a database are
+// skipped when the variable is not set. The database is wiped, so it must
+// never be one that matters.
+func newTestApplication(t *testing.T) *testApplication {
+	t.Helper()
+
+	dsn := os.Getenv("COMMENTS_TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("COMMENTS_TEST_DB_DSN is not set")
+	}
+
+	var settings serverConfig
+	settings.env = "testing"
+	settings.baseURL = "http://localhost:4000"
+	settings.defaultRole = "reader"
+	settings.db.dsn = dsn
+	settings.moderation.mode = data.ModerationNone
+	settings.reports.threshold = 3
+	settings.comments.maxDepth = 5
+	settings.comments.retention = 30 * 24 * time.Hour
+	settings.notifications.digestInterval = 24 * time.Hour
+	settings.notifications.unsubscribeSecret = "test-secret"
+	settings.outbox.maxAttempts = 8
+	settings.filter.maxLinks = 2
+	settings.filter.duplicateWindow = 24 * time.Hour
+	settings.filter.spamThreshold = 0.95
+
+	db, err := openDB(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	err = migrateDB(db, "up", nil, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every other table references one of these, so the cascade empties
+	// them all while leaving the seeded permissions and roles alone.
+	_, err = db.Exec(`TRUNCATE users, threads, email_outbox RESTART IDENTITY CASCADE`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transport := &mailer.MemoryTransport{}
+
+	app := &appDependencies{
+		config:            settings,
+		logger:            logger,
+		commentModel:      data.CommentModel{DB: db},
+		threadModel:       data.ThreadModel{DB: db},
+		revisionModel:     data.RevisionModel{DB: db},
+		reactionModel:     data.ReactionModel{DB: db},
+		reportModel:       data.ReportModel{DB: db},
+		mentionModel:      data.MentionModel{DB: db},
+		subscriptionModel: data.SubscriptionModel{DB: db},
+		notificationModel: data.NotificationModel{DB: db},
+		outboxModel:       data.OutboxModel{DB: db},
+		userModel:         data.UserModel{DB: db},
+		tokenModel:        data.TokenModel{DB: db},
+		permsModel:        data.PermsModel{DB: db},
+		roleModel:         data.RoleModel{DB: db},
+		activationLimiter: newKeyedLimiter(time.Minute, 3),
+		mailer:            mailer.New(transport, "Comments Community <no-reply@example.com>", ""),
+	}
+
+	err = app.newContentFilter()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Background work must be done with the database before it is closed.
+	t.Cleanup(app.wg.Wait)
+
+	return &testApplication{appDependencies: app, handler: app.routes(), transport: transport}
+}
+
+// newTestUser creates an activated user holding the permissions, and
+// returns them along with a token to authenticate as them.
+func (ta *testApplication) newTestUser(t *testing.T, username string, permissions ...string) (*data.User, string) {
+	t.Helper()
+
+	user := &data.User{
+		Username:  username,
+		Email:     username + "@example.com",
+		Activated: true,
+		Language:  "en",
+	}
+
+	err := user.Password.Set("pa55word1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ta.userModel.Insert(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(permissions) > 0 {
+		err = ta.permsModel.Add(user.ID, permissions...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	token, err := ta.tokenModel.New(user.ID, time.Hour, data.ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user, token.Plaintext
+}
+
+type testResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// do sends a request with the JSON body, if any, through the application's
+// routes, authenticated with the token unless it is empty. Header is given
+// as alternating names and values.
+func (ta *testApplication) do(t *testing.T, method string, target string, token string, body string, header ...string) testResponse {
+	t.Helper()
+
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+
+	r := httptest.NewRequest(method, target, reader)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+
+	w := httptest.NewRecorder()
+	ta.handler.ServeHTTP(w, r)
+
+	res := w.Result()
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testResponse{status: res.StatusCode, header: res.Header, body: b}
+}
+
+// decode unmarshals the response body into dst.
+func (res testResponse) decode(t *testing.T, dst any) {
+	t.Helper()
+
+	err := json.Unmarshal(res.body, dst)
+	if err != nil {
+		t.Fatalf("decoding %q: %v", res.body, err)
+	}
+}
+
+// expectStatus fails the test unless the response has the status.
+func (res testResponse) expectStatus(t *testing.T, status int) {
+	t.Helper()
+
+	if res.status != status {
+		t.Fatalf("got status %d; want %d: %s", res.status, status, res.body)
+	}
+}
+
+// commentResponse is the body of the responses carrying a single comment.
+type commentResponse struct {
+	Comment struct {
+		ID          int64          `json:"id"`
+		ThreadID    int64          `json:"thread_id"`
+		ParentID    *int64         `json:"parent_id"`
+		UserID      *int64         `json:"user_id"`
+		Content     string         `json:"content"`
+		Author      string         `json:"author"`
+		Version     int32          `json:"version"`
+		Score       int            `json:"score"`
+		Status      string         `json:"status"`
+		Reactions   map[string]int `json:"reactions"`
+		MyReactions []string       `json:"my_reactions"`
+	} `json:"comment"`
+}
+
+// createTestComment posts a comment as the user with the token and returns
+// it, failing the test unless it is created.
+func (ta *testApplication) createTestComment(t *testing.T, token string, body string) commentResponse {
+	t.Helper()
+
+	res := ta.do(t, http.MethodPost, "/v1/comments", token, body)
+	res.expectStatus(t, http.StatusCreated)
+
+	var created commentResponse
+	res.decode(t, &created)
+
+	return created
+}
+
+// lastEmailData returns the data of the newest email with the template
+// queued for the recipient, failing the test if there is none.
+func (ta *testApplication) lastEmailData(t *testing.T, recipient string, template string) map[string]any {
+	t.Helper()
+
+	var encoded []byte
+
+	err := ta.outboxModel.DB.QueryRow(`
+	SELECT data FROM email_outbox 
+	WHERE recipient = $1 AND template = $2 
+	ORDER BY id DESC 
+	LIMIT 1`, recipient, template).Scan(&encoded)
+	if err != nil {
+		t.Fatalf("finding %s for %s: %v", template, recipient, err)
+	}
+
+	var emailData map[string]any
+
+	err = json.Unmarshal(encoded, &emailData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return emailData
+}
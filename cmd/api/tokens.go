@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/thats-insane/comments/internal/data"
+	"github.com/thats-insane/comments/internal/validator"
+)
+
+func (a *appDependencies) createAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidateEmail(v, incomingData.Email)
+	data.ValidatePasswordPlaintext(v, incomingData.Password)
+
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := a.userModel.GetByEmail(incomingData.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.invalidCredentialsResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	match, err := user.Password.Matches(incomingData.Password)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	if !match {
+		a.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	if user.Disabled {
+		a.accountDisabledResponse(w, r)
+		return
+	}
+
+	token, err := a.tokenModel.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"authentication_token": token,
+	}
+
+	err = a.writeJSON(w, http.StatusCreated, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Email string `json:"email"`
+	}
+
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidateEmail(v, incomingData.Email)
+
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := a.userModel.GetByEmail(incomingData.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("email", "no matching email address found")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	if user.Disabled {
+		a.accountDisabledResponse(w, r)
+		return
+	}
+
+	if !user.Activated {
+		v.AddError("email", "user account must be activated")
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	token, err := a.tokenModel.New(user.ID, 45*time.Minute, data.ScopePasswordReset)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	err = a.outboxModel.Insert(user, "token_password_reset.tmpl", map[string]any{
+		"passwordResetToken": token.Plaintext,
+	})
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"message": "an email will be sent to you containing password reset instructions",
+	}
+
+	err = a.writeJSON(w, http.StatusAccepted, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// createActivationTokenHandler sends a fresh activation token to a user who
+// never received, or has lost, the one in their welcome email. Requests are
+// limited per email address so that it cannot be used to flood an inbox.
+func (a *appDependencies) createActivationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Email string `json:"email"`
+	}
+
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidateEmail(v, incomingData.Email)
+
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !a.activationLimiter.Allow(strings.ToLower(incomingData.Email)) {
+		a.rateLimitExceedResponse(w, r)
+		return
+	}
+
+	user, err := a.userModel.GetByEmail(incomingData.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("email", "no matching email address found")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	if user.Disabled {
+		a.accountDisabledResponse(w, r)
+		return
+	}
+
+	if user.Activated {
+		v.AddError("email", "user has already been activated")
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Only the newest token should work, so that an intercepted older email
+	// is of no use.
+	err = a.tokenModel.Reissue(user, 3*24*time.Hour, data.ScopeActivation, "token_activation.tmpl", func(token *data.Token) map[string]any {
+		return map[string]any{
+			"activationToken": token.Plaintext,
+		}
+	})
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"message": "an email will be sent to you containing activation instructions",
+	}
+
+	err = a.writeJSON(w, http.StatusAccepted, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCreateAuthenticationToken(t *testing.T) {
+	app := newTestApplication(t)
+
+	app.newTestUser(t, "alice")
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"valid credentials", `{"email": "alice@example.com", "password": "pa55word1234"}`, http.StatusCreated},
+		{"wrong password", `{"email": "alice@example.com", "password": "wrongpassword"}`, http.StatusUnauthorized},
+		{"unknown email", `{"email": "bob@example.com", "password": "pa55word1234"}`, http.StatusUnauthorized},
+		{"invalid email", `{"email": "alice", "password": "pa55word1234"}`, http.StatusUnprocessableEntity},
+		{"malformed body", `{"email": "alice@example.com"`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := app.do(t, http.MethodPost, "/v1/tokens/authentication", "", tt.body)
+			res.expectStatus(t, tt.status)
+		})
+	}
+
+	res := app.do(t, http.MethodPost, "/v1/tokens/authentication", "", `{"email": "alice@example.com", "password": "pa55word1234"}`)
+	res.expectStatus(t, http.StatusCreated)
+
+	var created struct {
+		Token struct {
+			Token string `json:"token"`
+		} `json:"authentication_token"`
+	}
+	res.decode(t, &created)
+
+	res = app.do(t, http.MethodGet, "/v1/users/me", created.Token.Token, "")
+	res.expectStatus(t, http.StatusOK)
+
+	res = app.do(t, http.MethodGet, "/v1/users/me", "ABCDEFGHIJKLMNOPQRSTUVWXYZ", "")
+	res.expectStatus(t, http.StatusUnauthorized)
+
+	res = app.do(t, http.MethodGet, "/v1/users/me", "", "", "Authorization", "Basic YWxpY2U6cGFzcw==")
+	res.expectStatus(t, http.StatusUnauthorized)
+}
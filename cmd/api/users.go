@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/thats-insane/comments/internal/data"
@@ -14,9 +15,10 @@ func (a *appDependencies) registerUserHandler(w http.ResponseWriter, r *http.Req
 		Username string `json:"username"`
 		Email    string `json:"email"`
 		Password string `json:"password"`
+		Language string `json:"language"`
 	}
 
-	err := a.readJSON(w, r, incomingData)
+	err := a.readJSON(w, r, &incomingData)
 	if err != nil {
 		a.badRequestResponse(w, r, err)
 		return
@@ -26,6 +28,11 @@ func (a *appDependencies) registerUserHandler(w http.ResponseWriter, r *http.Req
 		Username:  incomingData.Username,
 		Email:     incomingData.Email,
 		Activated: false,
+		Language:  incomingData.Language,
+	}
+
+	if user.Language == "" {
+		user.Language = "en"
 	}
 
 	err = user.Password.Set(incomingData.Password)
@@ -44,27 +51,81 @@ func (a *appDependencies) registerUserHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	err = a.userModel.Insert(user)
+	err = a.userModel.Register(user, a.config.defaultRole, 3*24*time.Hour, "user_welcome.tmpl", func(token *data.Token) map[string]any {
+		return map[string]any{
+			"activationToken": token.Plaintext,
+			"userID":          user.ID,
+		}
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDuplicateEmail):
 			v.AddError("email", "a user with this email already exists")
 			a.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateUsername):
+			v.AddError("username", "a user with this username already exists")
+			a.failedValidationResponse(w, r, v.Errors)
 		default:
 			a.serverErrResponse(w, r, err)
 		}
 		return
 	}
 
-	err = a.permsModel.Add(user.ID, "comments:read")
+	data := envelope{
+		"user": user,
+	}
+
+	err = a.writeJSON(w, http.StatusCreated, data, nil)
 	if err != nil {
 		a.serverErrResponse(w, r, err)
 		return
 	}
+}
 
-	token, err := a.tokenModel.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+func (a *appDependencies) activateUserHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		TokenPlaintext string `json:"token"`
+	}
+	err := a.readJSON(w, r, &incomingData)
 	if err != nil {
-		a.serverErrResponse(w, r, err)
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidateTokenPlaintext(v, incomingData.TokenPlaintext)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := a.userModel.GetForToken(data.ScopeActivation, incomingData.TokenPlaintext)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid/expired activation token")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	if user.Disabled {
+		a.accountDisabledResponse(w, r)
+		return
+	}
+
+	user.Activated = true
+	err = a.userModel.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
 		return
 	}
 
@@ -72,28 +133,221 @@ func (a *appDependencies) registerUserHandler(w http.ResponseWriter, r *http.Req
 		"user": user,
 	}
 
-	a.background(func() {
-		data := map[string]any{
-			"activationToken": token.Plaintext,
-			"userID":          user.ID,
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) updateUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Password       string `json:"password"`
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	data.ValidatePasswordPlaintext(v, incomingData.Password)
+	data.ValidateTokenPlaintext(v, incomingData.TokenPlaintext)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := a.userModel.GetForToken(data.ScopePasswordReset, incomingData.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid/expired password reset token")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrResponse(w, r, err)
 		}
-		err = a.mailer.Send(user.Email, "user_welcome.tmpl", data)
+		return
+	}
+
+	if user.Disabled {
+		a.accountDisabledResponse(w, r)
+		return
+	}
+
+	err = user.Password.Set(incomingData.Password)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	err = a.userModel.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	// The reset token is single-use, and any sessions opened with the old
+	// password should not survive the reset.
+	for _, scope := range []string{data.ScopePasswordReset, data.ScopeAuthentication} {
+		err = a.tokenModel.DeleteAllForUser(scope, user.ID)
 		if err != nil {
-			a.logger.Error(err.Error())
+			a.serverErrResponse(w, r, err)
+			return
 		}
-	})
+	}
 
-	err = a.writeJSON(w, http.StatusCreated, data, nil)
+	data := envelope{
+		"message": "your password was successfully reset",
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
 	if err != nil {
 		a.serverErrResponse(w, r, err)
+	}
+}
+
+// updateUserPreferencesHandler changes the notification preferences and the
+// email language of the authenticated user.
+func (a *appDependencies) updateUserPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		NotifyMentions *bool   `json:"notify_mentions"`
+		Language       *string `json:"language"`
+	}
+
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
 		return
 	}
+
+	user := a.contextGetUser(r)
+
+	if incomingData.NotifyMentions != nil {
+		user.NotifyMentions = *incomingData.NotifyMentions
+	}
+
+	if incomingData.Language != nil {
+		user.Language = *incomingData.Language
+	}
+
+	v := validator.New()
+
+	data.ValidateLanguage(v, user.Language)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.userModel.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			a.editConflictResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"user": user,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
 }
 
-func (a *appDependencies) activateUserHandler(w http.ResponseWriter, r *http.Request) {
+// requestEmailChangeHandler starts a change of the authenticated user's
+// email. The new address is only used once a token sent to it is redeemed
+// with confirmEmailChangeHandler, and the old address is told of the request.
+func (a *appDependencies) requestEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Email           string `json:"email"`
+		CurrentPassword string `json:"current_password"`
+	}
+
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := a.contextGetUser(r)
+
+	v := validator.New()
+
+	// A stolen session alone must not be enough to take over the account.
+	match, err := user.Password.Matches(incomingData.CurrentPassword)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	if !match {
+		v.AddError("current_password", "is incorrect")
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	data.ValidateEmail(v, incomingData.Email)
+	v.Check(!strings.EqualFold(incomingData.Email, user.Email), "email", "must be different from your current email")
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The address is checked again when the change is confirmed, as it may
+	// be taken in the meantime.
+	_, err = a.userModel.GetByEmail(incomingData.Email)
+	if err == nil {
+		v.AddError("email", "a user with this email already exists")
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !errors.Is(err, data.ErrRecordNotFound) {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	err = a.userModel.RequestEmailChange(user, incomingData.Email, 24*time.Hour, "token_email_change.tmpl", func(token *data.Token) map[string]any {
+		return map[string]any{
+			"username":         user.Username,
+			"emailChangeToken": token.Plaintext,
+		}
+	}, "user_email_change_requested.tmpl", map[string]any{
+		"username": user.Username,
+		"newEmail": incomingData.Email,
+	})
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	data := envelope{
+		"message": "an email will be sent to the new address containing instructions to confirm the change",
+	}
+
+	err = a.writeJSON(w, http.StatusAccepted, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) confirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
 	var incomingData struct {
 		TokenPlaintext string `json:"token"`
 	}
+
 	err := a.readJSON(w, r, &incomingData)
 	if err != nil {
 		a.badRequestResponse(w, r, err)
@@ -107,12 +361,31 @@ func (a *appDependencies) activateUserHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	user, err := a.userModel.GetForToken(data.ScopeActivation, incomingData.TokenPlaintext)
+	user, err := a.userModel.GetForToken(data.ScopeEmailChange, incomingData.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid/expired email change token")
+			a.failedValidationResponse(w, r, v.Errors)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	if user.Disabled {
+		a.accountDisabledResponse(w, r)
+		return
+	}
 
+	err = a.userModel.ConfirmPendingEmail(user)
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("email", "a user with this email already exists")
+			a.failedValidationResponse(w, r, v.Errors)
 		case errors.Is(err, data.ErrRecordNotFound):
-			v.AddError("token", "invalid/expired activation token")
+			v.AddError("token", "invalid/expired email change token")
 			a.failedValidationResponse(w, r, v.Errors)
 		default:
 			a.serverErrResponse(w, r, err)
@@ -120,10 +393,92 @@ func (a *appDependencies) activateUserHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	user.Activated = true
+	// Reset tokens went to the old address, and sessions may belong to
+	// whoever the change is meant to lock out, so none of them survive it.
+	for _, scope := range []string{data.ScopeEmailChange, data.ScopePasswordReset, data.ScopeAuthentication} {
+		err = a.tokenModel.DeleteAllForUser(scope, user.ID)
+		if err != nil {
+			a.serverErrResponse(w, r, err)
+			return
+		}
+	}
+
+	data := envelope{
+		"user": user,
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+func (a *appDependencies) displayCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	data := envelope{
+		"user": a.contextGetUser(r),
+	}
+
+	err := a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
+
+// updateCurrentUserHandler changes the authenticated user's username and
+// password. Changing the password requires the current one.
+func (a *appDependencies) updateCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Username        *string `json:"username"`
+		Password        *string `json:"password"`
+		CurrentPassword string  `json:"current_password"`
+	}
+
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := a.contextGetUser(r)
+
+	v := validator.New()
+
+	if incomingData.Username != nil {
+		user.Username = *incomingData.Username
+	}
+
+	if incomingData.Password != nil {
+		match, err := user.Password.Matches(incomingData.CurrentPassword)
+		if err != nil {
+			a.serverErrResponse(w, r, err)
+			return
+		}
+
+		if !match {
+			v.AddError("current_password", "is incorrect")
+			a.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		err = user.Password.Set(*incomingData.Password)
+		if err != nil {
+			a.serverErrResponse(w, r, err)
+			return
+		}
+	}
+
+	data.ValidateUser(v, user)
+	if !v.IsEmpty() {
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	err = a.userModel.Update(user)
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrDuplicateUsername):
+			v.AddError("username", "a user with this username already exists")
+			a.failedValidationResponse(w, r, v.Errors)
 		case errors.Is(err, data.ErrEditConflict):
 			a.editConflictResponse(w, r)
 		default:
@@ -132,6 +487,16 @@ func (a *appDependencies) activateUserHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	// An outstanding reset token would let someone holding it undo the
+	// change.
+	if incomingData.Password != nil {
+		err = a.tokenModel.DeleteAllForUser(data.ScopePasswordReset, user.ID)
+		if err != nil {
+			a.serverErrResponse(w, r, err)
+			return
+		}
+	}
+
 	data := envelope{
 		"user": user,
 	}
@@ -141,3 +506,53 @@ func (a *appDependencies) activateUserHandler(w http.ResponseWriter, r *http.Req
 		a.serverErrResponse(w, r, err)
 	}
 }
+
+// deleteCurrentUserHandler deletes the authenticated user's account once
+// they have confirmed their password. Their comments stay up, anonymised.
+func (a *appDependencies) deleteCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	var incomingData struct {
+		Password string `json:"password"`
+	}
+
+	err := a.readJSON(w, r, &incomingData)
+	if err != nil {
+		a.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := a.contextGetUser(r)
+
+	v := validator.New()
+
+	match, err := user.Password.Matches(incomingData.Password)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+		return
+	}
+
+	if !match {
+		v.AddError("password", "is incorrect")
+		a.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = a.userModel.Delete(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			a.notFoundResponse(w, r)
+		default:
+			a.serverErrResponse(w, r, err)
+		}
+		return
+	}
+
+	data := envelope{
+		"message": "your account was successfully deleted",
+	}
+
+	err = a.writeJSON(w, http.StatusOK, data, nil)
+	if err != nil {
+		a.serverErrResponse(w, r, err)
+	}
+}
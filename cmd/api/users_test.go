@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/thats-insane/comments/internal/data"
+)
+
+func TestPasswordReset(t *testing.T) {
+	app := newTestApplication(t)
+
+	_, token := app.newTestUser(t, "alice")
+
+	res := app.do(t, http.MethodPost, "/v1/tokens/password-reset", "", `{"email": "nobody@example.com"}`)
+	res.expectStatus(t, http.StatusUnprocessableEntity)
+
+	res = app.do(t, http.MethodPost, "/v1/tokens/password-reset", "", `{"email": "alice@example.com"}`)
+	res.expectStatus(t, http.StatusAccepted)
+
+	resetToken, _ := app.lastEmailData(t, "alice@example.com", "token_password_reset.tmpl")["passwordResetToken"].(string)
+
+	res = app.do(t, http.MethodPut, "/v1/users/password", "", `{"password": "n3wpa55word!", "token": "ABCDEFGHIJKLMNOPQRSTUVWXYZ"}`)
+	res.expectStatus(t, http.StatusUnprocessableEntity)
+
+	res = app.do(t, http.MethodPut, "/v1/users/password", "", `{"password": "n3wpa55word!", "token": "`+resetToken+`"}`)
+	res.expectStatus(t, http.StatusOK)
+
+	// The token is single-use, and the reset signs the user out everywhere.
+	res = app.do(t, http.MethodPut, "/v1/users/password", "", `{"password": "an0therpa55word", "token": "`+resetToken+`"}`)
+	res.expectStatus(t, http.StatusUnprocessableEntity)
+
+	res = app.do(t, http.MethodGet, "/v1/users/me", token, "")
+	res.expectStatus(t, http.StatusUnauthorized)
+
+	res = app.do(t, http.MethodPost, "/v1/tokens/authentication", "", `{"email": "alice@example.com", "password": "pa55word1234"}`)
+	res.expectStatus(t, http.StatusUnauthorized)
+
+	res = app.do(t, http.MethodPost, "/v1/tokens/authentication", "", `{"email": "alice@example.com", "password": "n3wpa55word!"}`)
+	res.expectStatus(t, http.StatusCreated)
+}
+
+func TestUsernamesAreUnique(t *testing.T) {
+	app := newTestApplication(t)
+
+	app.newTestUser(t, "alice")
+	_, bobToken := app.newTestUser(t, "bob")
+
+	res := app.do(t, http.MethodPost, "/v1/users", "", `{"username": "Alice", "email": "other@example.com", "password": "pa55word1234"}`)
+	res.expectStatus(t, http.StatusUnprocessableEntity)
+
+	res = app.do(t, http.MethodPatch, "/v1/users/me", bobToken, `{"username": "ALICE"}`)
+	res.expectStatus(t, http.StatusUnprocessableEntity)
+
+	res = app.do(t, http.MethodPatch, "/v1/users/me", bobToken, `{"username": "Bob"}`)
+	res.expectStatus(t, http.StatusOK)
+}
+
+func TestEmailChange(t *testing.T) {
+	app := newTestApplication(t)
+
+	_, token := app.newTestUser(t, "alice")
+
+	res := app.do(t, http.MethodPatch, "/v1/users/me/email", token, `{"email": "new@example.com", "current_password": "wrong-password"}`)
+	res.expectStatus(t, http.StatusUnprocessableEntity)
+
+	var changeTokens []string
+
+	for _, email := range []string{"first@example.com", "second@example.com"} {
+		res = app.do(t, http.MethodPatch, "/v1/users/me/email", token, `{"email": "`+email+`", "current_password": "pa55word1234"}`)
+		res.expectStatus(t, http.StatusAccepted)
+
+		changeToken, _ := app.lastEmailData(t, email, "token_email_change.tmpl")["emailChangeToken"].(string)
+		changeTokens = append(changeTokens, changeToken)
+
+		if app.lastEmailData(t, "alice@example.com", "user_email_change_requested.tmpl")["newEmail"] != email {
+			t.Errorf("the current address was not told about the change to %s", email)
+		}
+	}
+
+	// Only the token for the latest requested address works.
+	res = app.do(t, http.MethodPut, "/v1/users/me/email", "", `{"token": "`+changeTokens[0]+`"}`)
+	res.expectStatus(t, http.StatusUnprocessableEntity)
+
+	res = app.do(t, http.MethodPut, "/v1/users/me/email", "", `{"token": "`+changeTokens[1]+`"}`)
+	res.expectStatus(t, http.StatusOK)
+
+	res = app.do(t, http.MethodPost, "/v1/tokens/authentication", "", `{"email": "second@example.com", "password": "pa55word1234"}`)
+	res.expectStatus(t, http.StatusCreated)
+}
+
+func TestDeleteAccount(t *testing.T) {
+	app := newTestApplication(t)
+
+	_, aliceToken := app.newTestUser(t, "alice", "comments:read", "comments:write")
+	_, bobToken := app.newTestUser(t, "bob", "comments:read", "comments:write")
+
+	mine := app.createTestComment(t, aliceToken, `{"thread_key": "deletion", "content": "by alice"}`)
+	theirs := app.createTestComment(t, bobToken, `{"thread_key": "deletion", "content": "by bob"}`)
+
+	minePath := fmt.Sprintf("/v1/comments/%d", mine.Comment.ID)
+	theirsPath := fmt.Sprintf("/v1/comments/%d", theirs.Comment.ID)
+
+	res := app.do(t, http.MethodPatch, minePath, aliceToken, `{"content": "edited by alice"}`)
+	res.expectStatus(t, http.StatusOK)
+
+	res = app.do(t, http.MethodPost, theirsPath+"/reactions/upvote", aliceToken, "")
+	res.expectStatus(t, http.StatusOK)
+
+	res = app.do(t, http.MethodGet, theirsPath, bobToken, "")
+	res.expectStatus(t, http.StatusOK)
+
+	etag := res.header.Get("ETag")
+
+	res = app.do(t, http.MethodDelete, "/v1/users/me", aliceToken, `{"password": "wrong-password"}`)
+	res.expectStatus(t, http.StatusUnprocessableEntity)
+
+	res = app.do(t, http.MethodDelete, "/v1/users/me", aliceToken, `{"password": "pa55word1234"}`)
+	res.expectStatus(t, http.StatusOK)
+
+	res = app.do(t, http.MethodGet, minePath, bobToken, "")
+	res.expectStatus(t, http.StatusOK)
+
+	var kept commentResponse
+	res.decode(t, &kept)
+
+	if kept.Comment.Author != "[deleted]" || kept.Comment.UserID != nil {
+		t.Errorf("got author %q and user %v; want the comment anonymised", kept.Comment.Author, kept.Comment.UserID)
+	}
+
+	var revisionAuthor string
+
+	err := app.revisionModel.DB.QueryRow(`SELECT author FROM comment_revisions WHERE comment_id = $1`, mine.Comment.ID).Scan(&revisionAuthor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if revisionAuthor != "[deleted]" {
+		t.Errorf("got revision author %q; want it anonymised", revisionAuthor)
+	}
+
+	// Taking the vote back out changes the representation but is not an
+	// edit.
+	res = app.do(t, http.MethodGet, theirsPath, bobToken, "", "If-None-Match", etag)
+	res.expectStatus(t, http.StatusOK)
+
+	var unvoted commentResponse
+	res.decode(t, &unvoted)
+
+	if unvoted.Comment.Score != 0 || unvoted.Comment.Version != 1 {
+		t.Errorf("got score %d and version %d; want 0 and 1", unvoted.Comment.Score, unvoted.Comment.Version)
+	}
+}
+
+func TestDisabledAccounts(t *testing.T) {
+	app := newTestApplication(t)
+
+	alice, _ := app.newTestUser(t, "alice")
+
+	res := app.do(t, http.MethodPost, "/v1/tokens/password-reset", "", `{"email": "alice@example.com"}`)
+	res.expectStatus(t, http.StatusAccepted)
+
+	resetToken, _ := app.lastEmailData(t, "alice@example.com", "token_password_reset.tmpl")["passwordResetToken"].(string)
+
+	carol := &data.User{Username: "carol", Email: "carol@example.com", Language: "en"}
+
+	err := carol.Password.Set("pa55word1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.userModel.Insert(carol)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	activationToken, err := app.tokenModel.New(carol.ID, time.Hour, data.ScopeActivation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, user := range []*data.User{alice, carol} {
+		err = app.userModel.SetDisabled(user, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Tokens issued before the account was deactivated are of no use, and
+	// no new ones are handed out.
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+	}{
+		{"password reset token", http.MethodPost, "/v1/tokens/password-reset", `{"email": "alice@example.com"}`},
+		{"password reset", http.MethodPut, "/v1/users/password", `{"password": "n3wpa55word!", "token": "` + resetToken + `"}`},
+		{"activation", http.MethodPut, "/v1/users/activated", `{"token": "` + activationToken.Plaintext + `"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := app.do(t, tt.method, tt.target, "", tt.body)
+			res.expectStatus(t, http.StatusForbidden)
+		})
+	}
+
+	user, err := app.userModel.Get(carol.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.Activated {
+		t.Error("a deactivated account was activated")
+	}
+}
@@ -4,35 +4,86 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/lib/pq"
+	"github.com/thats-insane/comments/internal/markup"
 	"github.com/thats-insane/comments/internal/validator"
 )
 
+const (
+	CommentPending  = "pending"
+	CommentApproved = "approved"
+	CommentRejected = "rejected"
+)
+
 type Comment struct {
-	ID        int64     `json:"id"`
-	Content   string    `json:"content"`
-	Author    string    `json:"author"`
-	CreatedAt time.Time `json:"-"`
-	Version   int32     `json:"version"`
+	ID        int64      `json:"id"`
+	ThreadID  int64      `json:"thread_id"`
+	ParentID  *int64     `json:"parent_id"`
+	UserID    *int64     `json:"user_id"`
+	Content   string     `json:"content"`
+	Format    string     `json:"format"`
+	Author    string     `json:"author"`
+	CreatedAt time.Time  `json:"-"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	Version   int32      `json:"version"`
+	Score     int        `json:"score"`
+	Status    string     `json:"status"`
+	Replies   []*Comment `json:"replies,omitempty"`
+
+	// ETagVersion counts every change to the comment's representation,
+	// reactions and moderation included, where Version only counts edits.
+	ETagVersion int32 `json:"-"`
+
+	ContentHTML string `json:"content_html"`
+
+	ModerationReason *string `json:"moderation_reason,omitempty"`
+
+	Reactions   map[string]int `json:"reactions"`
+	MyReactions []string       `json:"my_reactions"`
+	Mentions    []*Mention     `json:"mentions"`
 }
 
 type CommentModel struct {
 	DB *sql.DB
 }
 
+// commentColumns is selected by every comment query, joined against users
+// so that the author reflects the current username of the comment's owner.
+// It must be kept in step with the scan order in scanComment.
+const commentColumns = `comments.id, comments.thread_id, comments.parent_id, comments.user_id, comments.created_at, 
+	comments.deleted_at, comments.content, COALESCE(users.username, comments.author), comments.version, comments.score, 
+	comments.status, comments.moderation_reason, comments.format, comments.etag_version`
+
+const commentJoins = `LEFT JOIN users ON users.id = comments.user_id`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanComment(row rowScanner, comment *Comment) error {
+	return row.Scan(&comment.ID, &comment.ThreadID, &comment.ParentID, &comment.UserID, &comment.CreatedAt,
+		&comment.DeletedAt, &comment.Content, &comment.Author, &comment.Version, &comment.Score,
+		&comment.Status, &comment.ModerationReason, &comment.Format, &comment.ETagVersion)
+}
+
 func (c CommentModel) Insert(comment *Comment) error {
 	query := `
-	INSERT INTO comments (content, author) 
-	VALUES ($1, $2) 
-	RETURNING id, created_at, version`
+	INSERT INTO comments (thread_id, parent_id, user_id, content, format, author, status, moderation_reason) 
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8) 
+	RETURNING id, created_at, version, etag_version`
 
-	args := []any{comment.Content, comment.Author}
+	args := []any{comment.ThreadID, comment.ParentID, comment.UserID, comment.Content, comment.Format, comment.Author, comment.Status, comment.ModerationReason}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return c.DB.QueryRowContext(ctx, query, args...).Scan(&comment.ID, &comment.CreatedAt, &comment.Version)
+	return c.DB.QueryRowContext(ctx, query, args...).Scan(&comment.ID, &comment.CreatedAt, &comment.Version, &comment.ETagVersion)
 }
 
 func (c CommentModel) Get(id int64) (*Comment, error) {
@@ -40,18 +91,19 @@ func (c CommentModel) Get(id int64) (*Comment, error) {
 		return nil, ErrRecordNotFound
 	}
 
-	query := `
-	SELECT id, created_at, content, author, version 
+	query := fmt.Sprintf(`
+	SELECT %s 
 	FROM comments 
-	WHERE id = $1
-	`
+	%s
+	WHERE comments.id = $1 AND comments.deleted_at IS NULL
+	`, commentColumns, commentJoins)
 
 	var comment Comment
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := c.DB.QueryRowContext(ctx, query, id).Scan(&comment.ID, &comment.CreatedAt, &comment.Content, &comment.Author, &comment.Version)
+	err := scanComment(c.DB.QueryRowContext(ctx, query, id), &comment)
 
 	if err != nil {
 		switch {
@@ -64,71 +116,414 @@ func (c CommentModel) Get(id int64) (*Comment, error) {
 	return &comment, nil
 }
 
-func (c CommentModel) GetAll(content string, author string, filters Filters) ([]*Comment, error) {
-	query := `
-	SELECT id, created_at, content, author, version 
-	FROM comments 
-	WHERE (to_tsvector('simple', content) @@ 
+// GetAll lists comments in the given thread, or across every thread when
+// threadID is zero.
+func (c CommentModel) GetAll(threadID int64, content string, author string, rootsOnly bool, filters Filters) ([]*Comment, Metadata, error) {
+	conditions := `
+	(to_tsvector('simple', comments.content) @@ 
 		plainto_tsquery('simple', $1) OR $1 = '') 
-    AND (to_tsvector('simple', author) @@ 
+    AND (to_tsvector('simple', COALESCE(users.username, comments.author)) @@ 
 		plainto_tsquery('simple', $2) OR $2 = '') 
-	ORDER BY id
-	LIMIT $3 OFFSET $4
+	AND (comments.thread_id = $3 OR $3 = 0)
+	AND (comments.parent_id IS NULL OR NOT $4)
+	AND comments.status = 'approved'
+	AND comments.deleted_at IS NULL
 	`
 
+	return c.list(conditions, []any{content, author, threadID, rootsOnly}, filters)
+}
+
+func (c CommentModel) GetReplies(parentID int64, filters Filters) ([]*Comment, Metadata, error) {
+	conditions := `comments.parent_id = $1 AND comments.status = 'approved' AND comments.deleted_at IS NULL`
+
+	return c.list(conditions, []any{parentID}, filters)
+}
+
+// GetPending lists the comments awaiting moderation.
+func (c CommentModel) GetPending(filters Filters) ([]*Comment, Metadata, error) {
+	conditions := `comments.status = 'pending' AND comments.deleted_at IS NULL`
+
+	return c.list(conditions, []any{}, filters)
+}
+
+// list returns a page of the comments matching conditions, whose arguments
+// are args, either by page number or by keyset from the filters' cursor.
+func (c CommentModel) list(conditions string, args []any, filters Filters) ([]*Comment, Metadata, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := c.DB.QueryContext(ctx, query, content, author, filters.limit(), filters.offset())
+	query := fmt.Sprintf(`
+	SELECT count(*)
+	FROM comments
+	%s
+	WHERE %s
+	`, commentJoins, conditions)
 
+	totalRecords := 0
+	err := c.DB.QueryRowContext(ctx, query, args...).Scan(&totalRecords)
 	if err != nil {
-		return nil, err
+		return nil, Metadata{}, err
 	}
 
-	comments := []*Comment{}
+	cursor, reverse := filters.keyset()
+	if cursor != nil {
+		keyset, keysetArgs := filters.keysetCondition("comments", cursor, reverse, len(args)+1)
+		conditions = fmt.Sprintf("(%s) AND %s", conditions, keyset)
+		args = append(args, keysetArgs...)
+	}
 
-	for rows.Next() {
-		var comment Comment
-		err := rows.Scan(&comment.ID, &comment.CreatedAt, &comment.Content, &comment.Author, &comment.Version)
+	// One row more than the page is fetched to find out whether another
+	// page follows it.
+	query = fmt.Sprintf(`
+	SELECT %s 
+	FROM comments 
+	%s
+	WHERE %s
+	ORDER BY %s
+	LIMIT $%d OFFSET $%d
+	`, commentColumns, commentJoins, conditions, filters.sortOrder("comments", reverse), len(args)+1, len(args)+2)
 
-		if err != nil {
-			return nil, err
+	args = append(args, filters.limit()+1, filters.offset())
+
+	rows, err := c.DB.QueryContext(ctx, query, args...)
+
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	comments, err := scanComments(rows)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	more := len(comments) > filters.limit()
+	if more {
+		comments = comments[:filters.limit()]
+	}
+
+	if reverse {
+		slices.Reverse(comments)
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	if len(comments) == 0 {
+		return comments, metadata, nil
+	}
+
+	first := commentCursor(comments[0], filters.Sort)
+	last := commentCursor(comments[len(comments)-1], filters.Sort)
+
+	switch {
+	case cursor == nil:
+		if more {
+			metadata.NextCursor = last
+		}
+	case reverse:
+		metadata.NextCursor = last
+		if more {
+			metadata.PrevCursor = first
+		}
+	default:
+		metadata.PrevCursor = first
+		if more {
+			metadata.NextCursor = last
 		}
+	}
 
-		comments = append(comments, &comment)
+	// Page numbers do not apply once a listing is followed by cursor.
+	if cursor != nil {
+		metadata.CurrentPage, metadata.FirstPage, metadata.LastPage = 0, 0, 0
 	}
 
-	err = rows.Err()
+	return comments, metadata, nil
+}
+
+// commentCursor returns the cursor positioned at the comment in the sort.
+func commentCursor(comment *Comment, sort string) string {
+	var value string
+
+	switch strings.TrimPrefix(sort, "-") {
+	case "created_at":
+		value = comment.CreatedAt.Format(time.RFC3339Nano)
+	case "score":
+		value = strconv.Itoa(comment.Score)
+	default:
+		value = strconv.FormatInt(comment.ID, 10)
+	}
+
+	return encodeCursor(sort, value, comment.ID)
+}
+
+// GetDescendants returns every reply below the given comments, down to
+// depth levels, ordered by id so that parents always precede their replies.
+// Deleted and unapproved replies are left out together with everything
+// beneath them.
+func (c CommentModel) GetDescendants(parentIDs []int64, depth int) ([]*Comment, error) {
+	if len(parentIDs) == 0 || depth < 1 {
+		return []*Comment{}, nil
+	}
+
+	query := fmt.Sprintf(`
+	WITH RECURSIVE replies AS (
+		SELECT id, 1 AS depth
+		FROM comments
+		WHERE parent_id = ANY($1) AND status = 'approved' AND deleted_at IS NULL
+		UNION ALL
+		SELECT comments.id, replies.depth + 1
+		FROM comments
+		INNER JOIN replies ON comments.parent_id = replies.id
+		WHERE replies.depth < $2 AND comments.status = 'approved' AND comments.deleted_at IS NULL
+	)
+	SELECT %s
+	FROM comments
+	%s
+	WHERE comments.id IN (SELECT id FROM replies)
+	ORDER BY comments.id
+	`, commentColumns, commentJoins)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := c.DB.QueryContext(ctx, query, pq.Array(parentIDs), depth)
+
 	if err != nil {
 		return nil, err
 	}
 
-	return comments, nil
+	defer rows.Close()
+
+	return scanComments(rows)
+}
+
+// Update saves the comment's new content, first recording the version it
+// replaces as a revision edited by editorID.
+func (c CommentModel) Update(comment *Comment, editorID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO comment_revisions (comment_id, version, content, format, author, editor_id)
+	SELECT comments.id, comments.version, comments.content, comments.format, COALESCE(users.username, comments.author), $3
+	FROM comments
+	LEFT JOIN users ON users.id = comments.user_id
+	WHERE comments.id = $1 AND comments.version = $2
+	`
+
+	result, err := tx.ExecContext(ctx, query, comment.ID, comment.Version, editorID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "comment_revisions_comment_id_version_key"`:
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	query = `
+	UPDATE comments 
+	SET content = $1, format = $2, version = version + 1, etag_version = etag_version + 1 
+	WHERE id = $3 AND version = $4
+	RETURNING version, etag_version
+	`
+
+	args := []any{comment.Content, comment.Format, comment.ID, comment.Version}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&comment.Version, &comment.ETagVersion)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Moderate moves the comment from status from to status, recording the
+// reason given by the moderator. It fails with ErrEditConflict if the
+// comment is no longer in status from, so that a decision is only ever
+// acted on once.
+func (c CommentModel) Moderate(id int64, from string, status string, reason *string, moderatorID int64) error {
+	query := `
+	UPDATE comments 
+	SET status = $1, moderation_reason = $2, moderated_by = $3, moderated_at = NOW(), hidden_by_reports = false, 
+		etag_version = etag_version + 1
+	WHERE id = $4 AND status = $5 AND deleted_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := c.DB.ExecContext(ctx, query, status, reason, moderatorID, id, from)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// Hide sends an approved comment back to the moderation queue without a
+// moderator, as happens when the content filter holds an edit or, with
+// byReports set, when the comment collects too many reports.
+func (c CommentModel) Hide(id int64, reason string, byReports bool) error {
+	query := `
+	UPDATE comments 
+	SET status = 'pending', moderation_reason = $1, hidden_by_reports = $3, etag_version = etag_version + 1
+	WHERE id = $2 AND status = 'approved' AND deleted_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := c.DB.ExecContext(ctx, query, reason, id, byReports)
+	return err
 }
 
-func (c CommentModel) Update(comment *Comment) error {
+// Unhide puts a comment that was hidden by reports back on display, and
+// reports whether it was. Comments held for any other reason, or since
+// decided on by a moderator, are left alone.
+func (c CommentModel) Unhide(id int64) (bool, error) {
 	query := `
 	UPDATE comments 
-	SET content = $1, author = $2, version = version + 1 
-	WHERE id = $3 
-	RETURNING version
+	SET status = 'approved', moderation_reason = NULL, hidden_by_reports = false, etag_version = etag_version + 1
+	WHERE id = $1 AND status = 'pending' AND hidden_by_reports AND deleted_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := c.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// HasApproved reports whether the user has had any comment approved, which
+// is what separates returning authors from first-time ones.
+func (c CommentModel) HasApproved(userID int64) (bool, error) {
+	query := `
+	SELECT EXISTS (
+		SELECT 1 FROM comments 
+		WHERE user_id = $1 AND status = 'approved' AND deleted_at IS NULL
+	)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var exists bool
+	err := c.DB.QueryRowContext(ctx, query, userID).Scan(&exists)
+
+	return exists, err
+}
+
+// HasDuplicate reports whether the user has posted the same content, other
+// than in comment excludeID, within the window.
+func (c CommentModel) HasDuplicate(userID int64, content string, excludeID int64, window time.Duration) (bool, error) {
+	query := `
+	SELECT EXISTS (
+		SELECT 1 FROM comments 
+		WHERE user_id = $1 AND lower(content) = lower($2) AND id <> $3 
+		AND created_at > NOW() - make_interval(secs => $4) AND deleted_at IS NULL
+	)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var exists bool
+	err := c.DB.QueryRowContext(ctx, query, userID, strings.TrimSpace(content), excludeID, window.Seconds()).Scan(&exists)
+
+	return exists, err
+}
+
+// GetModerated calls fn with the content of the most recent approved and
+// rejected comments, up to limit of each, and whether it was rejected. This
+// is what the spam classifier is trained on.
+func (c CommentModel) GetModerated(limit int, fn func(content string, rejected bool)) error {
+	query := `
+	SELECT content, status = 'rejected'
+	FROM (
+		SELECT content, status, row_number() OVER (PARTITION BY status ORDER BY id DESC) AS n
+		FROM comments 
+		WHERE status IN ('approved', 'rejected')
+	) AS moderated
+	WHERE n <= $1
 	`
 
-	args := []any{comment.Content, comment.Author, comment.ID}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return c.DB.QueryRowContext(ctx, query, args...).Scan(&comment.Version)
+	rows, err := c.DB.QueryContext(ctx, query, limit)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var content string
+		var rejected bool
+
+		err := rows.Scan(&content, &rejected)
+		if err != nil {
+			return err
+		}
+
+		fn(content, rejected)
+	}
+
+	return rows.Err()
 }
 
+// Delete moves the comment to the trash. It stays there, hidden from every
+// other query, until it is restored or purged.
 func (c CommentModel) Delete(id int64) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
 	query := `
-	DELETE FROM comment 
-	WHERE id =$1
+	UPDATE comments 
+	SET deleted_at = NOW()
+	WHERE id = $1 AND deleted_at IS NULL
 	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -151,9 +546,145 @@ func (c CommentModel) Delete(id int64) error {
 	return nil
 }
 
+// Restore takes the comment out of the trash. Its entity tag version is
+// bumped so that tags handed out before it was deleted no longer match.
+func (c CommentModel) Restore(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+	UPDATE comments 
+	SET deleted_at = NULL, etag_version = etag_version + 1
+	WHERE id = $1 AND deleted_at IS NOT NULL
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := c.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (c CommentModel) GetTrash(filters Filters) ([]*Comment, error) {
+	query := fmt.Sprintf(`
+	SELECT %s 
+	FROM comments 
+	%s
+	WHERE comments.deleted_at IS NOT NULL
+	ORDER BY comments.deleted_at DESC, comments.id
+	LIMIT $1 OFFSET $2
+	`, commentColumns, commentJoins)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := c.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanComments(rows)
+}
+
+// Purge permanently deletes comments that have been in the trash for longer
+// than retention. Comments which still have live replies, or replies still
+// within their own restore window, are kept, as removing them would cascade
+// to the replies.
+func (c CommentModel) Purge(retention time.Duration) (int64, error) {
+	query := `
+	DELETE FROM comments 
+	WHERE deleted_at < $1
+	AND NOT EXISTS (
+		SELECT 1 FROM comments AS replies 
+		WHERE replies.parent_id = comments.id
+		AND (replies.deleted_at IS NULL OR replies.deleted_at >= $1)
+	)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := c.DB.ExecContext(ctx, query, time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func scanComments(rows *sql.Rows) ([]*Comment, error) {
+	comments := []*Comment{}
+
+	for rows.Next() {
+		var comment Comment
+		err := scanComment(rows, &comment)
+
+		if err != nil {
+			return nil, err
+		}
+
+		comments = append(comments, &comment)
+	}
+
+	err := rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
+
+// NestReplies attaches each of the descendants to the Replies of its parent,
+// which must either be one of the comments or appear earlier in descendants.
+func NestReplies(comments []*Comment, descendants []*Comment) {
+	byID := make(map[int64]*Comment, len(comments)+len(descendants))
+	for _, comment := range comments {
+		byID[comment.ID] = comment
+	}
+
+	for _, reply := range descendants {
+		byID[reply.ID] = reply
+		if reply.ParentID == nil {
+			continue
+		}
+
+		parent, found := byID[*reply.ParentID]
+		if found {
+			parent.Replies = append(parent.Replies, reply)
+		}
+	}
+}
+
+// Flatten returns the comments together with all of their nested replies.
+func Flatten(comments []*Comment) []*Comment {
+	flattened := make([]*Comment, 0, len(comments))
+	for _, comment := range comments {
+		flattened = append(flattened, comment)
+		flattened = append(flattened, Flatten(comment.Replies)...)
+	}
+
+	return flattened
+}
+
 func ValidateComment(v *validator.Validator, comment *Comment) {
 	v.Check(comment.Content != "", "content", "must be provided")
-	v.Check(comment.Author != "", "author", "must be provided")
 	v.Check(len(comment.Content) <= 100, "content", "must not be more than 100 byte long")
-	v.Check(len(comment.Author) <= 25, "author", "must not be more than 25 bytes long")
+	v.Check(validator.PermittedValue(comment.Format, markup.Formats...), "format", "must be one of plain or markdown")
 }
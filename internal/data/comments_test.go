@@ -0,0 +1,43 @@
+package data
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNestReplies(t *testing.T) {
+	id := func(n int64) *int64 { return &n }
+
+	roots := []*Comment{{ID: 1}, {ID: 2}}
+	descendants := []*Comment{
+		{ID: 3, ParentID: id(1)},
+		{ID: 4, ParentID: id(3)},
+		{ID: 5, ParentID: id(2)},
+		{ID: 6, ParentID: id(1)},
+		{ID: 7, ParentID: id(99)},
+	}
+
+	NestReplies(roots, descendants)
+
+	if len(roots[0].Replies) != 2 || roots[0].Replies[0].ID != 3 || roots[0].Replies[1].ID != 6 {
+		t.Errorf("comment 1 has replies %v; want 3 and 6", roots[0].Replies)
+	}
+
+	if len(roots[0].Replies[0].Replies) != 1 || roots[0].Replies[0].Replies[0].ID != 4 {
+		t.Errorf("comment 3 has replies %v; want 4", roots[0].Replies[0].Replies)
+	}
+
+	if len(roots[1].Replies) != 1 || roots[1].Replies[0].ID != 5 {
+		t.Errorf("comment 2 has replies %v; want 5", roots[1].Replies)
+	}
+
+	var ids []int64
+	for _, comment := range Flatten(roots) {
+		ids = append(ids, comment.ID)
+	}
+
+	// The reply to a comment outside the tree is left out.
+	if want := []int64{1, 3, 4, 6, 2, 5}; !slices.Equal(ids, want) {
+		t.Errorf("Flatten gave %v; want %v", ids, want)
+	}
+}
@@ -4,4 +4,7 @@ import "errors"
 
 var ErrRecordNotFound = errors.New("record not found")
 var ErrDuplicateEmail = errors.New("duplicate email")
+var ErrDuplicateUsername = errors.New("duplicate username")
 var ErrEditConflict = errors.New("edit conflict")
+var ErrDuplicateReport = errors.New("duplicate report")
+var ErrEmailNotDead = errors.New("email not dead")
@@ -1,10 +1,43 @@
 package data
 
-import "github.com/thats-insane/comments/internal/validator"
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thats-insane/comments/internal/validator"
+)
 
 type Filters struct {
-	Page     int
-	PageSize int
+	Page         int
+	PageSize     int
+	Sort         string
+	SortSafelist []string
+	After        string
+	Before       string
+}
+
+type Metadata struct {
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+	PrevCursor   string `json:"prev_cursor,omitempty"`
+}
+
+// cursor marks a position in a keyset-paginated listing: the value of the
+// sort column and the id of the last row seen. The sort is included so that
+// a cursor cannot be replayed against a differently ordered listing.
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int64  `json:"id"`
 }
 
 func ValidateFilters(v *validator.Validator, f Filters) {
@@ -12,6 +45,27 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.Page <= 500, "page", "must be a maximum of 500")
 	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
+
+	if f.SortSafelist != nil {
+		v.Check(validator.PermittedValue(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+	}
+
+	v.Check(f.After == "" || f.Before == "", "after", "must not be combined with before")
+	v.Check(f.Page == 1 || (f.After == "" && f.Before == ""), "page", "must not be combined with a cursor")
+
+	for key, value := range map[string]string{"after": f.After, "before": f.Before} {
+		if value == "" {
+			continue
+		}
+
+		c, err := decodeCursor(value)
+		if err != nil {
+			v.AddError(key, "must be a valid cursor")
+			continue
+		}
+
+		v.Check(c.Sort == f.Sort, key, "must come from a listing with the same sort")
+	}
 }
 
 func (f Filters) limit() int {
@@ -21,3 +75,153 @@ func (f Filters) limit() int {
 func (f Filters) offset() int {
 	return (f.Page - 1) * f.PageSize
 }
+
+func (f Filters) sortColumn() string {
+	for _, safeValue := range f.SortSafelist {
+		if f.Sort == safeValue {
+			return strings.TrimPrefix(f.Sort, "-")
+		}
+	}
+
+	panic("unsafe sort parameter: " + f.Sort)
+}
+
+func (f Filters) sortDirection() string {
+	if strings.HasPrefix(f.Sort, "-") {
+		return "DESC"
+	}
+
+	return "ASC"
+}
+
+// sortOrder returns the ORDER BY clause for the sort, using the id of table
+// to break ties. With reverse set the order is flipped, as needed to read
+// backwards from a cursor.
+func (f Filters) sortOrder(table string, reverse bool) string {
+	direction := f.sortDirection()
+	if reverse {
+		direction = flipDirection(direction)
+	}
+
+	column := f.sortColumn()
+	if column == "id" {
+		return fmt.Sprintf("%s.id %s", table, direction)
+	}
+
+	return fmt.Sprintf("%s.%s %s, %s.id %s", table, column, direction, table, direction)
+}
+
+// keysetCondition returns the SQL condition selecting the rows of table that
+// come after c in the sort order, or before it when reverse is set, along
+// with its arguments, numbered from param.
+func (f Filters) keysetCondition(table string, c *cursor, reverse bool, param int) (string, []any) {
+	operator := ">"
+	if f.sortDirection() == "DESC" {
+		operator = "<"
+	}
+
+	if reverse {
+		operator = flipOperator(operator)
+	}
+
+	column := f.sortColumn()
+	if column == "id" {
+		return fmt.Sprintf("%s.id %s $%d", table, operator, param), []any{c.ID}
+	}
+
+	condition := fmt.Sprintf("(%s.%s, %s.id) %s ($%d::%s, $%d)", table, column, table, operator, param, cursorType(column), param+1)
+
+	return condition, []any{c.Value, c.ID}
+}
+
+// keyset returns the cursor the listing continues from, if any, and whether
+// the listing runs backwards from it.
+func (f Filters) keyset() (*cursor, bool) {
+	switch {
+	case f.After != "":
+		c, _ := decodeCursor(f.After)
+		return c, false
+	case f.Before != "":
+		c, _ := decodeCursor(f.Before)
+		return c, true
+	default:
+		return nil, false
+	}
+}
+
+func calculateMetadata(totalRecords int, page int, pageSize int) Metadata {
+	if totalRecords == 0 {
+		return Metadata{}
+	}
+
+	return Metadata{
+		CurrentPage:  page,
+		PageSize:     pageSize,
+		FirstPage:    1,
+		LastPage:     int(math.Ceil(float64(totalRecords) / float64(pageSize))),
+		TotalRecords: totalRecords,
+	}
+}
+
+func encodeCursor(sort string, value string, id int64) string {
+	js, _ := json.Marshal(cursor{Sort: sort, Value: value, ID: id})
+
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func decodeCursor(encoded string) (*cursor, error) {
+	js, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	var c cursor
+	err = json.Unmarshal(js, &c)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.ID < 1 {
+		return nil, fmt.Errorf("invalid cursor id %d", c.ID)
+	}
+
+	switch cursorType(strings.TrimPrefix(c.Sort, "-")) {
+	case "timestamptz":
+		_, err = time.Parse(time.RFC3339Nano, c.Value)
+	default:
+		_, err = strconv.ParseInt(c.Value, 10, 64)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+// cursorType returns the type a cursor value is cast to when compared with
+// column. Timestamp columns are named *_at; every other sortable column is
+// an integer.
+func cursorType(column string) string {
+	if strings.HasSuffix(column, "_at") {
+		return "timestamptz"
+	}
+
+	return "bigint"
+}
+
+func flipOperator(operator string) string {
+	if operator == ">" {
+		return "<"
+	}
+
+	return ">"
+}
+
+func flipDirection(direction string) string {
+	if direction == "ASC" {
+		return "DESC"
+	}
+
+	return "ASC"
+}
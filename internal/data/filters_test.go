@@ -0,0 +1,50 @@
+package data
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		sort  string
+		value string
+		id    int64
+	}{
+		{"id", "42", 42},
+		{"-score", "-3", 7},
+		{"created_at", "2024-05-01T12:30:00.123456Z", 9},
+	}
+
+	for _, tt := range tests {
+		c, err := decodeCursor(encodeCursor(tt.sort, tt.value, tt.id))
+		if err != nil {
+			t.Fatalf("sort %q: %v", tt.sort, err)
+		}
+
+		if c.Sort != tt.sort || c.Value != tt.value || c.ID != tt.id {
+			t.Errorf("got %+v; want {%s %s %d}", *c, tt.sort, tt.value, tt.id)
+		}
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	encode := func(js string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(js))
+	}
+
+	tests := map[string]string{
+		"not base64":        "!!!",
+		"not json":          encode("nope"),
+		"missing id":        encode(`{"s":"id","v":"1"}`),
+		"non-numeric value": encode(`{"s":"score","v":"high","id":1}`),
+		"bad timestamp":     encode(`{"s":"-created_at","v":"yesterday","id":1}`),
+	}
+
+	for name, encoded := range tests {
+		_, err := decodeCursor(encoded)
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
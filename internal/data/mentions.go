@@ -0,0 +1,200 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// maxMentions caps how many users a single comment can notify.
+const maxMentions = 10
+
+var mentionRX = regexp.MustCompile(`(?:^|[^\w@])@([\w.-]*\w)`)
+
+type Mention struct {
+	UserID   int64  `json:"user_id"`
+	Username string `json:"username"`
+}
+
+type MentionModel struct {
+	DB *sql.DB
+}
+
+// ParseMentions returns the distinct usernames mentioned as @username in
+// content, in the order they first appear.
+func ParseMentions(content string) []string {
+	seen := make(map[string]bool)
+	usernames := []string{}
+
+	for _, match := range mentionRX.FindAllStringSubmatch(content, -1) {
+		key := strings.ToLower(match[1])
+		if seen[key] {
+			continue
+		}
+
+		seen[key] = true
+		usernames = append(usernames, match[1])
+
+		if len(usernames) == maxMentions {
+			break
+		}
+	}
+
+	return usernames
+}
+
+// Set replaces the users mentioned by the comment with those named in
+// usernames, other than its author. Usernames are unique regardless of case,
+// so each names at most one user.
+func (m MentionModel) Set(comment *Comment, usernames []string) error {
+	lowered := make([]string, len(usernames))
+	for i, username := range usernames {
+		lowered[i] = strings.ToLower(username)
+	}
+
+	var authorID int64
+	if comment.UserID != nil {
+		authorID = *comment.UserID
+	}
+
+	query := `
+	WITH mentioned AS (
+		SELECT id AS user_id
+		FROM users
+		WHERE lower(username) = ANY($2) AND activated AND id <> $3
+	), removed AS (
+		DELETE FROM comment_mentions
+		WHERE comment_id = $1 AND user_id NOT IN (SELECT user_id FROM mentioned)
+	)
+	INSERT INTO comment_mentions (comment_id, user_id)
+	SELECT $1, user_id FROM mentioned
+	ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, comment.ID, pq.Array(lowered), authorID)
+	return err
+}
+
+// Notify marks the comment's mentions as notified and queues the email
+// built by email to the active users among those not already notified who
+// want to hear about mentions, all in one transaction.
+// Each mention is therefore notified exactly once, however many times the
+// comment is edited or moderated.
+func (m MentionModel) Notify(commentID int64, template string, email func(user *User) map[string]any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	users, err := takeUnnotified(ctx, tx, commentID)
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		err = insertEmail(ctx, tx, user.Email, user.Language, template, email(user))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func takeUnnotified(ctx context.Context, tx *sql.Tx, commentID int64) ([]*User, error) {
+	query := `
+	WITH notified AS (
+		UPDATE comment_mentions
+		SET notified_at = NOW()
+		WHERE comment_id = $1 AND notified_at IS NULL
+		RETURNING user_id
+	)
+	SELECT users.id, users.username, users.email, users.language
+	FROM notified
+	INNER JOIN users ON users.id = notified.user_id
+	WHERE users.notify_mentions AND users.activated AND users.disabled_at IS NULL
+	ORDER BY users.id
+	`
+
+	rows, err := tx.QueryContext(ctx, query, commentID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	users := []*User{}
+
+	for rows.Next() {
+		var user User
+
+		err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.Language)
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, &user)
+	}
+
+	return users, rows.Err()
+}
+
+// Attach fills in the users mentioned by each comment.
+func (m MentionModel) Attach(comments []*Comment) error {
+	if len(comments) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*Comment, len(comments))
+	ids := make([]int64, 0, len(comments))
+	for _, comment := range comments {
+		comment.Mentions = []*Mention{}
+
+		byID[comment.ID] = comment
+		ids = append(ids, comment.ID)
+	}
+
+	query := `
+	SELECT comment_mentions.comment_id, users.id, users.username
+	FROM comment_mentions
+	INNER JOIN users ON users.id = comment_mentions.user_id
+	WHERE comment_mentions.comment_id = ANY($1)
+	ORDER BY comment_mentions.comment_id, users.username
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var commentID int64
+		var mention Mention
+
+		err := rows.Scan(&commentID, &mention.UserID, &mention.Username)
+		if err != nil {
+			return err
+		}
+
+		byID[commentID].Mentions = append(byID[commentID].Mentions, &mention)
+	}
+
+	return rows.Err()
+}
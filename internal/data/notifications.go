@@ -0,0 +1,217 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// NotificationItem is a new comment a user is being told about.
+type NotificationItem struct {
+	CommentID int64
+	ParentID  *int64
+	ThreadKey string
+	Author    string
+	Content   string
+}
+
+// Digest collects the comments a user is being told about in one email.
+type Digest struct {
+	User  *User
+	Items []*NotificationItem
+}
+
+type NotificationModel struct {
+	DB *sql.DB
+}
+
+// Enqueue records a notification of the comment for every user subscribed
+// to its thread or to the comment it replies to, other than its author.
+// Users subscribed both ways are notified once, immediately if either
+// subscription asks for that. A comment is only ever notified once per
+// user, however many times it is published.
+func (n NotificationModel) Enqueue(comment *Comment) error {
+	query := `
+	WITH recipients AS (
+		SELECT DISTINCT ON (subscriptions.user_id) subscriptions.user_id, subscriptions.mode
+		FROM subscriptions
+		INNER JOIN users ON users.id = subscriptions.user_id
+		WHERE (subscriptions.thread_id = $2 OR subscriptions.comment_id = $3)
+		AND subscriptions.user_id <> $4 AND users.activated
+		ORDER BY subscriptions.user_id, subscriptions.mode = 'immediate' DESC
+	)
+	INSERT INTO notifications (user_id, comment_id, mode)
+	SELECT user_id, $1, mode FROM recipients
+	ON CONFLICT (user_id, comment_id) DO NOTHING
+	`
+
+	var authorID int64
+	if comment.UserID != nil {
+		authorID = *comment.UserID
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := n.DB.ExecContext(ctx, query, comment.ID, comment.ThreadID, comment.ParentID, authorID)
+	return err
+}
+
+// SendImmediate marks the comment's unsent immediate notifications as sent
+// and queues the email built by email to each recipient other than disabled
+// accounts, all in one transaction. A notification is therefore never
+// marked as sent without its email being queued.
+func (n NotificationModel) SendImmediate(commentID int64, template string, email func(user *User) map[string]any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := n.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	users, err := takeImmediate(ctx, tx, commentID)
+	if err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		err = insertEmail(ctx, tx, user.Email, user.Language, template, email(user))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func takeImmediate(ctx context.Context, tx *sql.Tx, commentID int64) ([]*User, error) {
+	query := `
+	WITH sent AS (
+		UPDATE notifications
+		SET sent_at = NOW()
+		WHERE comment_id = $1 AND mode = 'immediate' AND sent_at IS NULL
+		RETURNING user_id
+	)
+	SELECT users.id, users.username, users.email, users.language
+	FROM sent
+	INNER JOIN users ON users.id = sent.user_id
+	WHERE users.disabled_at IS NULL
+	ORDER BY users.id
+	`
+
+	rows, err := tx.QueryContext(ctx, query, commentID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	users := []*User{}
+
+	for rows.Next() {
+		var user User
+
+		err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.Language)
+		if err != nil {
+			return nil, err
+		}
+
+		users = append(users, &user)
+	}
+
+	return users, rows.Err()
+}
+
+// SendDigests queues a digest, built by email, to every user whose oldest
+// unsent digest notification has waited for at least interval, and marks
+// the notifications in it as sent, all in one transaction. Notifications of
+// comments that have since been deleted or unpublished, and those for
+// disabled accounts, are dropped. It returns the number of digests queued.
+func (n NotificationModel) SendDigests(interval time.Duration, template string, email func(digest *Digest) map[string]any) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := n.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	digests, err := takeDigests(ctx, tx, interval)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, digest := range digests {
+		err = insertEmail(ctx, tx, digest.User.Email, digest.User.Language, template, email(digest))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return len(digests), nil
+}
+
+func takeDigests(ctx context.Context, tx *sql.Tx, interval time.Duration) ([]*Digest, error) {
+	query := `
+	WITH due AS (
+		SELECT user_id
+		FROM notifications
+		WHERE mode = 'digest' AND sent_at IS NULL
+		GROUP BY user_id
+		HAVING min(created_at) <= $1
+	), sent AS (
+		UPDATE notifications
+		SET sent_at = NOW()
+		WHERE mode = 'digest' AND sent_at IS NULL AND user_id IN (SELECT user_id FROM due)
+		RETURNING user_id, comment_id
+	)
+	SELECT users.id, users.username, users.email, users.language, comments.id, comments.parent_id, threads.key,
+		COALESCE(authors.username, comments.author), comments.content
+	FROM sent
+	INNER JOIN users ON users.id = sent.user_id
+	INNER JOIN comments ON comments.id = sent.comment_id
+	INNER JOIN threads ON threads.id = comments.thread_id
+	LEFT JOIN users AS authors ON authors.id = comments.user_id
+	WHERE comments.status = 'approved' AND comments.deleted_at IS NULL AND users.disabled_at IS NULL
+	ORDER BY users.id, comments.id
+	`
+
+	rows, err := tx.QueryContext(ctx, query, time.Now().Add(-interval))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	digests := []*Digest{}
+	var digest *Digest
+
+	for rows.Next() {
+		var user User
+		var item NotificationItem
+
+		err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.Language, &item.CommentID, &item.ParentID, &item.ThreadKey, &item.Author, &item.Content)
+		if err != nil {
+			return nil, err
+		}
+
+		if digest == nil || digest.User.ID != user.ID {
+			digest = &Digest{User: &user}
+			digests = append(digests, digest)
+		}
+
+		digest.Items = append(digest.Items, &item)
+	}
+
+	return digests, rows.Err()
+}
@@ -0,0 +1,307 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/thats-insane/comments/internal/validator"
+)
+
+const (
+	EmailPending = "pending"
+	EmailSending = "sending"
+	EmailSent    = "sent"
+	EmailDead    = "dead"
+)
+
+var EmailStatuses = []string{EmailPending, EmailSending, EmailSent, EmailDead}
+
+// claimTimeout is how long a message may sit claimed before it is assumed
+// that the worker sending it died and another may claim it.
+const claimTimeout = 10 * time.Minute
+
+// Email is a message waiting in, or passed through, the outbox. Data is
+// handed to Template when the message is sent; it is cleared afterwards as
+// it often holds tokens.
+type Email struct {
+	ID            int64          `json:"id"`
+	Recipient     string         `json:"recipient"`
+	Locale        string         `json:"locale"`
+	Template      string         `json:"template"`
+	Data          map[string]any `json:"-"`
+	Status        string         `json:"status"`
+	Attempts      int            `json:"attempts"`
+	LastError     *string        `json:"last_error"`
+	NextAttemptAt time.Time      `json:"next_attempt_at"`
+	CreatedAt     time.Time      `json:"created_at"`
+	SentAt        *time.Time     `json:"sent_at"`
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx, so that an email can be
+// queued as part of a larger transaction.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func insertEmail(ctx context.Context, db execer, recipient string, locale string, template string, data map[string]any) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO email_outbox (recipient, locale, template, data)
+	VALUES ($1, $2, $3, $4)
+	`
+
+	_, err = db.ExecContext(ctx, query, recipient, locale, template, encoded)
+	return err
+}
+
+type OutboxModel struct {
+	DB *sql.DB
+}
+
+// Insert queues an email to the user to be sent by the outbox workers, in
+// the user's language.
+func (o OutboxModel) Insert(user *User, template string, data map[string]any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return insertEmail(ctx, o.DB, user.Email, user.Language, template, data)
+}
+
+// Claim takes up to limit messages that are due, marking them as being sent
+// and counting the attempt. Messages claimed by a worker that has since
+// died are reclaimed once claimTimeout has passed.
+func (o OutboxModel) Claim(limit int) ([]*Email, error) {
+	query := `
+	UPDATE email_outbox
+	SET status = 'sending', attempts = attempts + 1, claimed_at = NOW()
+	WHERE id IN (
+		SELECT id FROM email_outbox
+		WHERE (status = 'pending' AND next_attempt_at <= NOW())
+		OR (status = 'sending' AND claimed_at < NOW() - make_interval(secs => $2))
+		ORDER BY next_attempt_at, id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING id, recipient, locale, template, data, status, attempts, last_error, next_attempt_at, created_at, sent_at
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := o.DB.QueryContext(ctx, query, limit, claimTimeout.Seconds())
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanEmails(rows)
+}
+
+func (o OutboxModel) MarkSent(id int64) error {
+	query := `
+	UPDATE email_outbox
+	SET status = 'sent', sent_at = NOW(), data = '{}', last_error = NULL
+	WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := o.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+// MarkFailed records a failed attempt. The message is retried at
+// nextAttempt, or moved to the dead-letter state if nextAttempt is nil.
+func (o OutboxModel) MarkFailed(id int64, sendErr error, nextAttempt *time.Time) error {
+	query := `
+	UPDATE email_outbox
+	SET status = 'pending', last_error = $2, next_attempt_at = $3
+	WHERE id = $1
+	`
+
+	args := []any{id, sendErr.Error(), nextAttempt}
+
+	if nextAttempt == nil {
+		query = `
+		UPDATE email_outbox
+		SET status = 'dead', last_error = $2
+		WHERE id = $1
+		`
+		args = args[:2]
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := o.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (o OutboxModel) Get(id int64) (*Email, error) {
+	query := `
+	SELECT id, recipient, locale, template, data, status, attempts, last_error, next_attempt_at, created_at, sent_at
+	FROM email_outbox
+	WHERE id = $1
+	`
+
+	var email Email
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := scanEmail(o.DB.QueryRowContext(ctx, query, id), &email)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &email, nil
+}
+
+// GetAll lists the messages in the outbox, newest first, optionally only
+// those with the given status.
+func (o OutboxModel) GetAll(status string, filters Filters) ([]*Email, Metadata, error) {
+	query := `
+	SELECT count(*) OVER(), id, recipient, locale, template, status, attempts, last_error, next_attempt_at, created_at, sent_at
+	FROM email_outbox
+	WHERE status = $1 OR $1 = ''
+	ORDER BY id DESC
+	LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := o.DB.QueryContext(ctx, query, status, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	emails := []*Email{}
+
+	for rows.Next() {
+		var email Email
+
+		err := rows.Scan(&totalRecords, &email.ID, &email.Recipient, &email.Locale, &email.Template, &email.Status, &email.Attempts,
+			&email.LastError, &email.NextAttemptAt, &email.CreatedAt, &email.SentAt)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		emails = append(emails, &email)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return emails, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// Retry puts a dead message back in the queue with a fresh set of attempts.
+// Messages whose data has been scrubbed cannot be retried.
+func (o OutboxModel) Retry(id int64) error {
+	query := `
+	UPDATE email_outbox
+	SET status = 'pending', attempts = 0, next_attempt_at = NOW()
+	WHERE id = $1 AND status = 'dead' AND data <> '{}'
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := o.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEmailNotDead
+	}
+
+	return nil
+}
+
+// ScrubDead clears the data of dead messages queued more than retention
+// ago. Sent messages lose theirs straight away; dead ones keep it for a
+// while so that they can be retried, but not for good, as it often holds
+// tokens and personal details.
+func (o OutboxModel) ScrubDead(retention time.Duration) (int64, error) {
+	query := `
+	UPDATE email_outbox
+	SET data = '{}'
+	WHERE status = 'dead' AND data <> '{}' AND created_at < $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := o.DB.ExecContext(ctx, query, time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func scanEmail(row rowScanner, email *Email) error {
+	var encoded []byte
+
+	err := row.Scan(&email.ID, &email.Recipient, &email.Locale, &email.Template, &encoded, &email.Status, &email.Attempts,
+		&email.LastError, &email.NextAttemptAt, &email.CreatedAt, &email.SentAt)
+	if err != nil {
+		return err
+	}
+
+	// Decode numbers as json.Number so that IDs are printed by the templates
+	// as they were queued rather than in float notation.
+	dec := json.NewDecoder(bytes.NewReader(encoded))
+	dec.UseNumber()
+
+	return dec.Decode(&email.Data)
+}
+
+func scanEmails(rows *sql.Rows) ([]*Email, error) {
+	emails := []*Email{}
+
+	for rows.Next() {
+		var email Email
+
+		err := scanEmail(rows, &email)
+		if err != nil {
+			return nil, err
+		}
+
+		emails = append(emails, &email)
+	}
+
+	return emails, rows.Err()
+}
+
+func ValidateEmailStatus(v *validator.Validator, status string) {
+	v.Check(status == "" || validator.PermittedValue(status, EmailStatuses...), "status", "must be one of pending, sending, sent or dead")
+}
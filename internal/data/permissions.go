@@ -19,6 +19,8 @@ func (p Perms) Include(code string) bool {
 	return slices.Contains(p, code)
 }
 
+// GetAll returns the codes of the permissions the user holds, whether
+// granted directly or through one of their roles.
 func (p PermsModel) GetAll(id int64) (Perms, error) {
 	query := `
 		SELECT permissions.code
@@ -27,6 +29,12 @@ func (p PermsModel) GetAll(id int64) (Perms, error) {
 		users_permissions.permission_id = permissions.id
 		INNER JOIN users ON users_permissions.user_id = users.id
         WHERE users.id = $1
+		UNION
+		SELECT permissions.code
+		FROM permissions
+		INNER JOIN roles_permissions ON roles_permissions.permission_id = permissions.id
+		INNER JOIN users_roles ON users_roles.role_id = roles_permissions.role_id
+		WHERE users_roles.user_id = $1
 	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -62,6 +70,25 @@ func (p PermsModel) Add(id int64, codes ...string) error {
 		INSERT INTO users_permissions
         SELECT $1, permissions.id FROM permissions 
         WHERE permissions.code = ANY($2)
+		ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := p.DB.ExecContext(ctx, query, id, pq.Array(codes))
+
+	return err
+}
+
+// Remove takes the directly granted permissions away from the user.
+// Permissions the user holds through a role are unaffected.
+func (p PermsModel) Remove(id int64, codes ...string) error {
+	query := `
+		DELETE FROM users_permissions
+		USING permissions
+		WHERE users_permissions.permission_id = permissions.id
+		AND users_permissions.user_id = $1 AND permissions.code = ANY($2)
 	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
@@ -71,3 +98,37 @@ func (p PermsModel) Add(id int64, codes ...string) error {
 
 	return err
 }
+
+// Codes returns the code of every permission that exists.
+func (p PermsModel) Codes() ([]string, error) {
+	query := `
+		SELECT code
+		FROM permissions
+		ORDER BY code
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := p.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	codes := []string{}
+
+	for rows.Next() {
+		var code string
+
+		err := rows.Scan(&code)
+		if err != nil {
+			return nil, err
+		}
+
+		codes = append(codes, code)
+	}
+
+	return codes, rows.Err()
+}
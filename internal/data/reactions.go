@@ -0,0 +1,235 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/thats-insane/comments/internal/validator"
+)
+
+const (
+	ReactionLike     = "like"
+	ReactionUpvote   = "upvote"
+	ReactionDownvote = "downvote"
+)
+
+var ReactionKinds = []string{ReactionLike, ReactionUpvote, ReactionDownvote}
+
+type ReactionModel struct {
+	DB *sql.DB
+}
+
+// Add records the user's reaction to the comment. Votes are exclusive, so
+// an upvote replaces an earlier downvote and vice versa.
+func (r ReactionModel) Add(commentID int64, userID int64, kind string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	var opposite string
+	switch kind {
+	case ReactionUpvote:
+		opposite = ReactionDownvote
+	case ReactionDownvote:
+		opposite = ReactionUpvote
+	}
+
+	if opposite != "" {
+		err = removeReaction(ctx, tx, commentID, userID, opposite)
+		if err != nil && !errors.Is(err, ErrRecordNotFound) {
+			return err
+		}
+	}
+
+	query := `
+	INSERT INTO comment_reactions (comment_id, user_id, kind)
+	VALUES ($1, $2, $3)
+	ON CONFLICT DO NOTHING
+	`
+
+	result, err := tx.ExecContext(ctx, query, commentID, userID, kind)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected > 0 {
+		err = adjustScore(ctx, tx, commentID, reactionWeight(kind))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r ReactionModel) Remove(commentID int64, userID int64, kind string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	err = removeReaction(ctx, tx, commentID, userID, kind)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func removeReaction(ctx context.Context, tx *sql.Tx, commentID int64, userID int64, kind string) error {
+	query := `
+	DELETE FROM comment_reactions
+	WHERE comment_id = $1 AND user_id = $2 AND kind = $3
+	`
+
+	result, err := tx.ExecContext(ctx, query, commentID, userID, kind)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return adjustScore(ctx, tx, commentID, -reactionWeight(kind))
+}
+
+// adjustScore keeps comments.score, the net of up and down votes, in step
+// with the reactions so that listings can sort by it. The entity tag
+// version is bumped for every reaction, votes or not, as the reactions are
+// part of the comment's representation. The version is left alone: it
+// counts edits, which clients lock on and revisions are recorded for.
+func adjustScore(ctx context.Context, tx *sql.Tx, commentID int64, delta int) error {
+	query := `
+	UPDATE comments
+	SET score = score + $2, etag_version = etag_version + 1
+	WHERE id = $1
+	`
+
+	_, err := tx.ExecContext(ctx, query, commentID, delta)
+	return err
+}
+
+func reactionWeight(kind string) int {
+	switch kind {
+	case ReactionUpvote:
+		return 1
+	case ReactionDownvote:
+		return -1
+	default:
+		return 0
+	}
+}
+
+// Attach fills in the reaction counts of each comment, along with the
+// reactions left on it by userID.
+func (r ReactionModel) Attach(comments []*Comment, userID int64) error {
+	if len(comments) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*Comment, len(comments))
+	ids := make([]int64, 0, len(comments))
+	for _, comment := range comments {
+		comment.Reactions = make(map[string]int, len(ReactionKinds))
+		for _, kind := range ReactionKinds {
+			comment.Reactions[kind] = 0
+		}
+		comment.MyReactions = []string{}
+
+		byID[comment.ID] = comment
+		ids = append(ids, comment.ID)
+	}
+
+	query := `
+	SELECT comment_id, kind, count(*)
+	FROM comment_reactions
+	WHERE comment_id = ANY($1)
+	GROUP BY comment_id, kind
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var commentID int64
+		var kind string
+		var count int
+
+		err := rows.Scan(&commentID, &kind, &count)
+		if err != nil {
+			return err
+		}
+
+		byID[commentID].Reactions[kind] = count
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	query = `
+	SELECT comment_id, kind
+	FROM comment_reactions
+	WHERE comment_id = ANY($1) AND user_id = $2
+	ORDER BY comment_id, kind
+	`
+
+	mine, err := r.DB.QueryContext(ctx, query, pq.Array(ids), userID)
+	if err != nil {
+		return err
+	}
+
+	defer mine.Close()
+
+	for mine.Next() {
+		var commentID int64
+		var kind string
+
+		err := mine.Scan(&commentID, &kind)
+		if err != nil {
+			return err
+		}
+
+		byID[commentID].MyReactions = append(byID[commentID].MyReactions, kind)
+	}
+
+	return mine.Err()
+}
+
+func ValidateReactionKind(v *validator.Validator, kind string) {
+	v.Check(slices.Contains(ReactionKinds, kind), "kind", "must be one of like, upvote or downvote")
+}
@@ -0,0 +1,219 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/thats-insane/comments/internal/validator"
+)
+
+const (
+	ReportOpen      = "open"
+	ReportResolved  = "resolved"
+	ReportDismissed = "dismissed"
+)
+
+var ReportReasons = []string{"spam", "harassment", "hate", "misinformation", "off_topic", "other"}
+
+type Report struct {
+	ID        int64     `json:"id"`
+	CommentID int64     `json:"comment_id"`
+	UserID    int64     `json:"user_id"`
+	Reason    string    `json:"reason"`
+	Note      string    `json:"note"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReportGroup collects the open reports against a single comment.
+type ReportGroup struct {
+	Comment     *Comment       `json:"comment"`
+	ReportCount int            `json:"report_count"`
+	Reasons     map[string]int `json:"reasons"`
+	Reports     []*Report      `json:"reports"`
+}
+
+type ReportModel struct {
+	DB *sql.DB
+}
+
+func (r ReportModel) Insert(report *Report) error {
+	query := `
+	INSERT INTO comment_reports (comment_id, user_id, reason, note)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, status, created_at
+	`
+
+	args := []any{report.CommentID, report.UserID, report.Reason, report.Note}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := r.DB.QueryRowContext(ctx, query, args...).Scan(&report.ID, &report.Status, &report.CreatedAt)
+
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "comment_reports_comment_id_user_id_key"`:
+			return ErrDuplicateReport
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r ReportModel) CountOpen(commentID int64) (int, error) {
+	query := `
+	SELECT count(*)
+	FROM comment_reports
+	WHERE comment_id = $1 AND status = 'open'
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	count := 0
+	err := r.DB.QueryRowContext(ctx, query, commentID).Scan(&count)
+
+	return count, err
+}
+
+// GetOpen lists the comments with open reports against them, most reported
+// first, each with the reports themselves.
+func (r ReportModel) GetOpen(filters Filters) ([]*ReportGroup, Metadata, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	query := `
+	SELECT count(*) OVER(), comment_reports.comment_id, count(*)
+	FROM comment_reports
+	INNER JOIN comments ON comments.id = comment_reports.comment_id
+	WHERE comment_reports.status = 'open' AND comments.deleted_at IS NULL
+	GROUP BY comment_reports.comment_id
+	ORDER BY count(*) DESC, comment_reports.comment_id
+	LIMIT $1 OFFSET $2
+	`
+
+	rows, err := r.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	groups := []*ReportGroup{}
+	byComment := make(map[int64]*ReportGroup)
+	ids := []int64{}
+
+	for rows.Next() {
+		var commentID int64
+		group := &ReportGroup{Reasons: make(map[string]int), Reports: []*Report{}}
+
+		err := rows.Scan(&totalRecords, &commentID, &group.ReportCount)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		groups = append(groups, group)
+		byComment[commentID] = group
+		ids = append(ids, commentID)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	if len(ids) == 0 {
+		return groups, metadata, nil
+	}
+
+	query = `
+	SELECT id, comment_id, user_id, reason, note, status, created_at
+	FROM comment_reports
+	WHERE comment_id = ANY($1) AND status = 'open'
+	ORDER BY id
+	`
+
+	reports, err := r.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer reports.Close()
+
+	for reports.Next() {
+		var report Report
+
+		err := reports.Scan(&report.ID, &report.CommentID, &report.UserID, &report.Reason, &report.Note, &report.Status, &report.CreatedAt)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		group := byComment[report.CommentID]
+		group.Reports = append(group.Reports, &report)
+		group.Reasons[report.Reason]++
+	}
+
+	err = reports.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	query = fmt.Sprintf(`
+	SELECT %s
+	FROM comments
+	%s
+	WHERE comments.id = ANY($1)
+	`, commentColumns, commentJoins)
+
+	commentRows, err := r.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer commentRows.Close()
+
+	comments, err := scanComments(commentRows)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	for _, comment := range comments {
+		byComment[comment.ID].Comment = comment
+	}
+
+	return groups, metadata, nil
+}
+
+// Close marks every open report against the comment as resolved or
+// dismissed by the moderator.
+func (r ReportModel) Close(commentID int64, status string, moderatorID int64) (int64, error) {
+	query := `
+	UPDATE comment_reports
+	SET status = $1, closed_by = $2, closed_at = NOW()
+	WHERE comment_id = $3 AND status = 'open'
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := r.DB.ExecContext(ctx, query, status, moderatorID, commentID)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func ValidateReport(v *validator.Validator, report *Report) {
+	v.Check(validator.PermittedValue(report.Reason, ReportReasons...), "reason", "must be one of spam, harassment, hate, misinformation, off_topic or other")
+	v.Check(len(report.Note) <= 500, "note", "must not be more than 500 bytes long")
+}
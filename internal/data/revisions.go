@@ -0,0 +1,90 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Revision is a snapshot of a comment as it was at Version, recorded when
+// the user EditorID replaced it with the next version at EditedAt.
+type Revision struct {
+	ID        int64     `json:"id"`
+	CommentID int64     `json:"comment_id"`
+	Version   int32     `json:"version"`
+	Content   string    `json:"content"`
+	Format    string    `json:"format"`
+	Author    string    `json:"author"`
+	EditorID  *int64    `json:"editor_id"`
+	EditedAt  time.Time `json:"edited_at"`
+}
+
+type RevisionModel struct {
+	DB *sql.DB
+}
+
+func (r RevisionModel) Get(commentID int64, version int32) (*Revision, error) {
+	query := `
+	SELECT id, comment_id, version, content, format, author, editor_id, created_at
+	FROM comment_revisions
+	WHERE comment_id = $1 AND version = $2
+	`
+
+	var revision Revision
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := r.DB.QueryRowContext(ctx, query, commentID, version).Scan(&revision.ID, &revision.CommentID, &revision.Version, &revision.Content, &revision.Format, &revision.Author, &revision.EditorID, &revision.EditedAt)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &revision, nil
+}
+
+func (r RevisionModel) GetAll(commentID int64, filters Filters) ([]*Revision, error) {
+	query := `
+	SELECT id, comment_id, version, content, format, author, editor_id, created_at
+	FROM comment_revisions
+	WHERE comment_id = $1
+	ORDER BY version DESC
+	LIMIT $2 OFFSET $3
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := r.DB.QueryContext(ctx, query, commentID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	revisions := []*Revision{}
+
+	for rows.Next() {
+		var revision Revision
+		err := rows.Scan(&revision.ID, &revision.CommentID, &revision.Version, &revision.Content, &revision.Format, &revision.Author, &revision.EditorID, &revision.EditedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		revisions = append(revisions, &revision)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
@@ -0,0 +1,126 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Role is a named bundle of permissions that can be granted to users as a
+// whole.
+type Role struct {
+	Code        string `json:"code"`
+	Permissions Perms  `json:"permissions"`
+}
+
+type RoleModel struct {
+	DB *sql.DB
+}
+
+func (m RoleModel) GetAll() ([]*Role, error) {
+	query := `
+		SELECT roles.code, array_remove(array_agg(permissions.code ORDER BY permissions.code), NULL)
+		FROM roles
+		LEFT JOIN roles_permissions ON roles_permissions.role_id = roles.id
+		LEFT JOIN permissions ON permissions.id = roles_permissions.permission_id
+		GROUP BY roles.id
+		ORDER BY roles.id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	roles := []*Role{}
+
+	for rows.Next() {
+		var role Role
+		var perms []string
+
+		err := rows.Scan(&role.Code, pq.Array(&perms))
+		if err != nil {
+			return nil, err
+		}
+
+		role.Permissions = perms
+		roles = append(roles, &role)
+	}
+
+	return roles, rows.Err()
+}
+
+// GetForUser returns the codes of the roles granted to the user.
+func (m RoleModel) GetForUser(userID int64) ([]string, error) {
+	query := `
+		SELECT roles.code
+		FROM roles
+		INNER JOIN users_roles ON users_roles.role_id = roles.id
+		WHERE users_roles.user_id = $1
+		ORDER BY roles.id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	codes := []string{}
+
+	for rows.Next() {
+		var code string
+
+		err := rows.Scan(&code)
+		if err != nil {
+			return nil, err
+		}
+
+		codes = append(codes, code)
+	}
+
+	return codes, rows.Err()
+}
+
+// Grant gives the user the role. Granting a role the user already has is
+// not an error.
+func (m RoleModel) Grant(userID int64, code string) error {
+	query := `
+		INSERT INTO users_roles
+		SELECT $1, roles.id FROM roles
+		WHERE roles.code = $2
+		ON CONFLICT DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, code)
+	return err
+}
+
+func (m RoleModel) Revoke(userID int64, code string) error {
+	query := `
+		DELETE FROM users_roles
+		USING roles
+		WHERE users_roles.role_id = roles.id
+		AND users_roles.user_id = $1 AND roles.code = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, userID, code)
+	return err
+}
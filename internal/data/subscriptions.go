@@ -0,0 +1,147 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/thats-insane/comments/internal/validator"
+)
+
+const (
+	DeliveryImmediate = "immediate"
+	DeliveryDigest    = "digest"
+)
+
+var DeliveryModes = []string{DeliveryImmediate, DeliveryDigest}
+
+// Subscription asks for the user to be notified of new comments in a
+// thread, or of replies to a comment. Exactly one of ThreadID and
+// CommentID is set.
+type Subscription struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"-"`
+	ThreadID  *int64    `json:"thread_id,omitempty"`
+	CommentID *int64    `json:"comment_id,omitempty"`
+	Mode      string    `json:"mode"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type SubscriptionModel struct {
+	DB *sql.DB
+}
+
+// Upsert saves the subscription, changing the delivery mode of an existing
+// subscription by the same user to the same thread or comment.
+func (s SubscriptionModel) Upsert(subscription *Subscription) error {
+	target := `(user_id, thread_id) WHERE thread_id IS NOT NULL`
+	if subscription.CommentID != nil {
+		target = `(user_id, comment_id) WHERE comment_id IS NOT NULL`
+	}
+
+	query := `
+	INSERT INTO subscriptions (user_id, thread_id, comment_id, mode)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT ` + target + ` DO UPDATE SET mode = EXCLUDED.mode
+	RETURNING id, created_at
+	`
+
+	args := []any{subscription.UserID, subscription.ThreadID, subscription.CommentID, subscription.Mode}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return s.DB.QueryRowContext(ctx, query, args...).Scan(&subscription.ID, &subscription.CreatedAt)
+}
+
+// Delete removes the user's subscription to the thread or the comment,
+// whichever is non-zero.
+func (s SubscriptionModel) Delete(userID int64, threadID int64, commentID int64) error {
+	query := `
+	DELETE FROM subscriptions
+	WHERE user_id = $1 AND (thread_id = $2 OR comment_id = $3)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := s.DB.ExecContext(ctx, query, userID, threadID, commentID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// DeleteAllForUser removes every subscription the user has, along with any
+// notifications still waiting for their digest.
+func (s SubscriptionModel) DeleteAllForUser(userID int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM subscriptions WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM notifications WHERE user_id = $1 AND sent_at IS NULL`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s SubscriptionModel) GetAllForUser(userID int64) ([]*Subscription, error) {
+	query := `
+	SELECT id, user_id, thread_id, comment_id, mode, created_at
+	FROM subscriptions
+	WHERE user_id = $1
+	ORDER BY id
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := s.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	subscriptions := []*Subscription{}
+
+	for rows.Next() {
+		var subscription Subscription
+
+		err := rows.Scan(&subscription.ID, &subscription.UserID, &subscription.ThreadID, &subscription.CommentID, &subscription.Mode, &subscription.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		subscriptions = append(subscriptions, &subscription)
+	}
+
+	return subscriptions, rows.Err()
+}
+
+func ValidateDeliveryMode(v *validator.Validator, mode string) {
+	v.Check(validator.PermittedValue(mode, DeliveryModes...), "mode", "must be one of immediate or digest")
+}
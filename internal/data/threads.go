@@ -0,0 +1,129 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/thats-insane/comments/internal/validator"
+)
+
+const (
+	ModerationAll       = "all"
+	ModerationFirstTime = "first-time"
+	ModerationNone      = "none"
+)
+
+var ModerationModes = []string{ModerationAll, ModerationFirstTime, ModerationNone}
+
+type Thread struct {
+	ID         int64     `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	Key        string    `json:"key"`
+	Moderation *string   `json:"moderation"`
+}
+
+type ThreadModel struct {
+	DB *sql.DB
+}
+
+// GetOrCreate returns the thread with the given key, creating it first if
+// no comment has been posted to it yet.
+func (t ThreadModel) GetOrCreate(key string) (*Thread, error) {
+	query := `
+	INSERT INTO threads (key)
+	VALUES ($1)
+	ON CONFLICT (key) DO UPDATE SET key = EXCLUDED.key
+	RETURNING id, created_at, key, moderation
+	`
+
+	var thread Thread
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := t.DB.QueryRowContext(ctx, query, key).Scan(&thread.ID, &thread.CreatedAt, &thread.Key, &thread.Moderation)
+	if err != nil {
+		return nil, err
+	}
+
+	return &thread, nil
+}
+
+func (t ThreadModel) GetByKey(key string) (*Thread, error) {
+	query := `
+	SELECT id, created_at, key, moderation
+	FROM threads
+	WHERE key = $1
+	`
+
+	var thread Thread
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := t.DB.QueryRowContext(ctx, query, key).Scan(&thread.ID, &thread.CreatedAt, &thread.Key, &thread.Moderation)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &thread, nil
+}
+
+func (t ThreadModel) Get(id int64) (*Thread, error) {
+	query := `
+	SELECT id, created_at, key, moderation
+	FROM threads
+	WHERE id = $1
+	`
+
+	var thread Thread
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := t.DB.QueryRowContext(ctx, query, id).Scan(&thread.ID, &thread.CreatedAt, &thread.Key, &thread.Moderation)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &thread, nil
+}
+
+// Update saves the thread's moderation mode. A nil mode falls back to the
+// server-wide default.
+func (t ThreadModel) Update(thread *Thread) error {
+	query := `
+	UPDATE threads
+	SET moderation = $1
+	WHERE id = $2
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := t.DB.ExecContext(ctx, query, thread.Moderation, thread.ID)
+	return err
+}
+
+func ValidateThreadKey(v *validator.Validator, key string) {
+	v.Check(key != "", "thread_key", "must be provided")
+	v.Check(len(key) <= 255, "thread_key", "must not be more than 255 bytes long")
+}
+
+func ValidateModerationMode(v *validator.Validator, key string, mode string) {
+	v.Check(validator.PermittedValue(mode, ModerationModes...), key, "must be one of all, first-time or none")
+}
@@ -0,0 +1,33 @@
+package data
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/thats-insane/comments/internal/validator"
+)
+
+func TestValidateThreadKey(t *testing.T) {
+	tests := []struct {
+		name  string
+		key   string
+		valid bool
+	}{
+		{"slug", "hello-world", true},
+		{"page path", "/blog/2024/05/hello-world", true},
+		{"url", "https://example.com/blog/hello-world?ref=home#comments", true},
+		{"empty", "", false},
+		{"too long", strings.Repeat("a", 256), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateThreadKey(v, tt.key)
+
+			if v.IsEmpty() != tt.valid {
+				t.Errorf("got errors %v; want valid = %t", v.Errors, tt.valid)
+			}
+		})
+	}
+}
@@ -2,23 +2,28 @@ package data
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
-	"math/rand"
 	"time"
 
 	"github.com/thats-insane/comments/internal/validator"
 )
 
-const ScopeActivation = "activation"
+const (
+	ScopeActivation     = "activation"
+	ScopeAuthentication = "authentication"
+	ScopePasswordReset  = "password-reset"
+	ScopeEmailChange    = "email-change"
+)
 
 type Token struct {
-	Plaintext string
-	Hash      []byte
-	UserID    int64
-	Expiry    time.Time
-	Scope     string
+	Plaintext string    `json:"token"`
+	Hash      []byte    `json:"-"`
+	UserID    int64     `json:"-"`
+	Expiry    time.Time `json:"expiry"`
+	Scope     string    `json:"-"`
 }
 
 func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
@@ -87,3 +92,83 @@ func (t TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	_, err := t.DB.ExecContext(ctx, query, scope, userID)
 	return err
 }
+
+// DeleteExpired removes every token past its expiry.
+func (t TokenModel) DeleteExpired() (int64, error) {
+	query := `
+		DELETE FROM tokens 
+        WHERE expiry < NOW()
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := t.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// DeleteAllScopesForUser removes every token the user holds, signing them
+// out everywhere.
+func (t TokenModel) DeleteAllScopesForUser(userID int64) error {
+	query := `
+		DELETE FROM tokens 
+        WHERE user_id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := t.DB.ExecContext(ctx, query, userID)
+	return err
+}
+
+// Reissue replaces the user's tokens of the scope with a new one and queues
+// the email built by email from it, all in one transaction, so that a
+// failure leaves the old token in place rather than none at all.
+func (t TokenModel) Reissue(user *User, ttl time.Duration, scope string, template string, email func(token *Token) map[string]any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	query := `
+		DELETE FROM tokens 
+        WHERE scope = $1 AND user_id = $2
+	`
+
+	_, err = tx.ExecContext(ctx, query, scope, user.ID)
+	if err != nil {
+		return err
+	}
+
+	token, err := generateToken(user.ID, ttl, scope)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO tokens (hash, user_id, expiry, scope) 
+        VALUES ($1, $2, $3, $4)
+	`
+
+	_, err = tx.ExecContext(ctx, query, token.Hash, token.UserID, token.Expiry, token.Scope)
+	if err != nil {
+		return err
+	}
+
+	err = insertEmail(ctx, tx, user.Email, user.Language, template, email(token))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -5,6 +5,8 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"fmt"
+	"regexp"
 	"time"
 
 	"github.com/thats-insane/comments/internal/validator"
@@ -13,6 +15,10 @@ import (
 
 var AnonymousUser = &User{}
 
+// LanguageRX matches the language tags users may choose for their emails, a
+// language optionally followed by a region.
+var LanguageRX = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+
 type User struct {
 	ID        int64     `json:"id"`
 	CreatedAt time.Time `json:"created_at"`
@@ -20,7 +26,11 @@ type User struct {
 	Email     string    `json:"email"`
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
+	Disabled  bool      `json:"disabled"`
 	Version   int       `json:"-"`
+
+	NotifyMentions bool   `json:"notify_mentions"`
+	Language       string `json:"language"`
 }
 
 type password struct {
@@ -38,22 +48,24 @@ func (u *User) IsAnon() bool {
 
 func (u UserModel) Insert(user *User) error {
 	query := `
-	INSERT INTO users (username, email, password_hash, activated)
-	VALUES ($1, $2, $3, $4)
-	RETURNING id, created_at, version
+	INSERT INTO users (username, email, password_hash, activated, language)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at, notify_mentions, language, version
 	`
 
-	args := []any{user.Username, user.Email, user.Password.hash, user.Activated}
+	args := []any{user.Username, user.Email, user.Password.hash, user.Activated, user.Language}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := u.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	err := u.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.NotifyMentions, &user.Language, &user.Version)
 
 	if err != nil {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
 			return ErrDuplicateEmail
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_username_key"`:
+			return ErrDuplicateUsername
 		default:
 			return err
 		}
@@ -64,7 +76,7 @@ func (u UserModel) Insert(user *User) error {
 
 func (u UserModel) GetByEmail(email string) (*User, error) {
 	query := `
-		SELECT id, created_at, username, email, password_hash, activated, version
+		SELECT id, created_at, username, email, password_hash, activated, disabled_at IS NOT NULL, notify_mentions, language, version
 		FROM users
 		WHERE email = $1
 	`
@@ -74,7 +86,7 @@ func (u UserModel) GetByEmail(email string) (*User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := u.DB.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.CreatedAt, &user.Username, &user.Email, &user.Password.hash, &user.Activated, &user.Version)
+	err := u.DB.QueryRowContext(ctx, query, email).Scan(&user.ID, &user.CreatedAt, &user.Username, &user.Email, &user.Password.hash, &user.Activated, &user.Disabled, &user.NotifyMentions, &user.Language, &user.Version)
 
 	if err != nil {
 		switch {
@@ -91,12 +103,12 @@ func (u UserModel) GetByEmail(email string) (*User, error) {
 func (u UserModel) Update(user *User) error {
 	query := `
 		UPDATE users 
-        SET username = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
-        WHERE id = $5 AND version = $6
+        SET username = $1, email = $2, password_hash = $3, activated = $4, notify_mentions = $5, language = $6, version = version + 1
+        WHERE id = $7 AND version = $8
         RETURNING version
 	`
 
-	args := []any{user.Username, user.Email, user.Password.hash, user.Activated, user.ID, user.Version}
+	args := []any{user.Username, user.Email, user.Password.hash, user.Activated, user.NotifyMentions, user.Language, user.ID, user.Version}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -107,6 +119,8 @@ func (u UserModel) Update(user *User) error {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
 			return ErrDuplicateEmail
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_username_key"`:
+			return ErrDuplicateUsername
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
 		default:
@@ -150,6 +164,10 @@ func ValidateEmail(v *validator.Validator, email string) {
 	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email")
 }
 
+func ValidateLanguage(v *validator.Validator, language string) {
+	v.Check(validator.Matches(language, LanguageRX), "language", "must be a language tag such as en or es-MX")
+}
+
 func ValidatePasswordPlaintext(v *validator.Validator, password string) {
 	v.Check(password != "", "password", "must be provided")
 	v.Check(len(password) >= 8, "password", "must be at least 8 bytes")
@@ -161,6 +179,7 @@ func ValidateUser(v *validator.Validator, user *User) {
 	v.Check(len(user.Username) <= 200, "username", "must be less than 200 bytes")
 
 	ValidateEmail(v, user.Email)
+	ValidateLanguage(v, user.Language)
 
 	if user.Password.plaintext != nil {
 		ValidatePasswordPlaintext(v, *user.Password.plaintext)
@@ -174,7 +193,7 @@ func ValidateUser(v *validator.Validator, user *User) {
 func (u UserModel) GetForToken(scope string, plaintext string) (*User, error) {
 	hash := sha256.Sum256([]byte(plaintext))
 	query := `
-		SELECT users.id, users.created_at, users.username, users.email, users.password_hash, users.activated, users.version
+		SELECT users.id, users.created_at, users.username, users.email, users.password_hash, users.activated, users.disabled_at IS NOT NULL, users.notify_mentions, users.language, users.version
         FROM users
         INNER JOIN tokens
         ON users.id = tokens.user_id
@@ -189,7 +208,7 @@ func (u UserModel) GetForToken(scope string, plaintext string) (*User, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := u.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Username, &user.Email, &user.Password.hash, &user.Activated, &user.Version)
+	err := u.DB.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Username, &user.Email, &user.Password.hash, &user.Activated, &user.Disabled, &user.NotifyMentions, &user.Language, &user.Version)
 
 	if err != nil {
 		switch {
@@ -202,3 +221,376 @@ func (u UserModel) GetForToken(scope string, plaintext string) (*User, error) {
 
 	return &user, nil
 }
+
+// RequestEmailChange records the address the user wants to change to,
+// replaces any email change token they hold with a new one, and queues the
+// confirmation email built by confirm from that token to the new address
+// along with the notice to the current one, all in one transaction. The
+// email is only replaced once confirmed with ConfirmPendingEmail.
+func (u UserModel) RequestEmailChange(user *User, email string, ttl time.Duration, confirmTemplate string, confirm func(token *Token) map[string]any, noticeTemplate string, notice map[string]any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := u.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	query := `
+		UPDATE users
+		SET pending_email = $2
+		WHERE id = $1
+	`
+
+	_, err = tx.ExecContext(ctx, query, user.ID, email)
+	if err != nil {
+		return err
+	}
+
+	// Only the token for the latest requested address should work.
+	query = `
+		DELETE FROM tokens 
+        WHERE scope = $1 AND user_id = $2
+	`
+
+	_, err = tx.ExecContext(ctx, query, ScopeEmailChange, user.ID)
+	if err != nil {
+		return err
+	}
+
+	token, err := generateToken(user.ID, ttl, ScopeEmailChange)
+	if err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO tokens (hash, user_id, expiry, scope) 
+        VALUES ($1, $2, $3, $4)
+	`
+
+	_, err = tx.ExecContext(ctx, query, token.Hash, token.UserID, token.Expiry, token.Scope)
+	if err != nil {
+		return err
+	}
+
+	err = insertEmail(ctx, tx, email, user.Language, confirmTemplate, confirm(token))
+	if err != nil {
+		return err
+	}
+
+	err = insertEmail(ctx, tx, user.Email, user.Language, noticeTemplate, notice)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ConfirmPendingEmail swaps the user's email for their pending address. The
+// address may have been taken by another account since it was requested, in
+// which case ErrDuplicateEmail is returned.
+func (u UserModel) ConfirmPendingEmail(user *User) error {
+	query := `
+		UPDATE users
+		SET email = pending_email, pending_email = NULL, version = version + 1
+		WHERE id = $1 AND pending_email IS NOT NULL
+		RETURNING email, version
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := u.DB.QueryRowContext(ctx, query, user.ID).Scan(&user.Email, &user.Version)
+
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+			return ErrDuplicateEmail
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Register inserts the user along with their role and an activation
+// token, and queues the welcome email built by welcome from that token, all
+// in one transaction. A user is therefore never created without the email
+// they need to activate their account.
+func (u UserModel) Register(user *User, role string, activationTTL time.Duration, template string, welcome func(token *Token) map[string]any) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := u.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO users (username, email, password_hash, activated, language)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id, created_at, notify_mentions, language, version
+	`
+
+	args := []any{user.Username, user.Email, user.Password.hash, user.Activated, user.Language}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.NotifyMentions, &user.Language, &user.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+			return ErrDuplicateEmail
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_username_key"`:
+			return ErrDuplicateUsername
+		default:
+			return err
+		}
+	}
+
+	query = `
+	INSERT INTO users_roles
+	SELECT $1, roles.id FROM roles
+	WHERE roles.code = $2
+	`
+
+	_, err = tx.ExecContext(ctx, query, user.ID, role)
+	if err != nil {
+		return err
+	}
+
+	token, err := generateToken(user.ID, activationTTL, ScopeActivation)
+	if err != nil {
+		return err
+	}
+
+	query = `
+	INSERT INTO tokens (hash, user_id, expiry, scope) 
+	VALUES ($1, $2, $3, $4)
+	`
+
+	_, err = tx.ExecContext(ctx, query, token.Hash, token.UserID, token.Expiry, token.Scope)
+	if err != nil {
+		return err
+	}
+
+	err = insertEmail(ctx, tx, user.Email, user.Language, template, welcome(token))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes the user along with their tokens, permissions,
+// subscriptions and reactions, taking their votes back out of the scores
+// of the comments they reacted to. Their comments, and the revisions of
+// them, are kept but credited to "[deleted]", and any email addressed to
+// them is dropped from the outbox.
+func (u UserModel) Delete(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := u.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	query := `
+	UPDATE comments
+	SET author = '[deleted]'
+	WHERE user_id = $1
+	`
+
+	_, err = tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	// The earlier versions of their comments must not give them away
+	// either.
+	query = `
+	UPDATE comment_revisions
+	SET author = '[deleted]'
+	WHERE comment_id IN (SELECT id FROM comments WHERE user_id = $1)
+	`
+
+	_, err = tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	// The reactions go with the user, but the scores are kept as running
+	// totals, so the user's votes must come off them first.
+	query = `
+	UPDATE comments
+	SET score = comments.score - votes.delta, etag_version = comments.etag_version + 1
+	FROM (
+		SELECT comment_id, SUM(CASE kind WHEN 'upvote' THEN 1 WHEN 'downvote' THEN -1 ELSE 0 END) AS delta
+		FROM comment_reactions
+		WHERE user_id = $1
+		GROUP BY comment_id
+	) AS votes
+	WHERE comments.id = votes.comment_id AND votes.delta <> 0
+	`
+
+	_, err = tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	query = `
+	DELETE FROM email_outbox
+	WHERE recipient IN (
+		SELECT email::text FROM users WHERE id = $1
+		UNION
+		SELECT pending_email::text FROM users WHERE id = $1 AND pending_email IS NOT NULL
+	)
+	`
+
+	_, err = tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	query = `
+	DELETE FROM users
+	WHERE id = $1
+	`
+
+	result, err := tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return tx.Commit()
+}
+
+const userColumns = `users.id, users.created_at, users.username, users.email, users.password_hash, users.activated,
+	users.disabled_at IS NOT NULL, users.notify_mentions, users.language, users.version`
+
+func scanUser(row rowScanner, user *User) error {
+	return row.Scan(&user.ID, &user.CreatedAt, &user.Username, &user.Email, &user.Password.hash, &user.Activated,
+		&user.Disabled, &user.NotifyMentions, &user.Language, &user.Version)
+}
+
+func (u UserModel) Get(id int64) (*User, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM users
+		WHERE users.id = $1
+	`, userColumns)
+
+	var user User
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := scanUser(u.DB.QueryRowContext(ctx, query, id), &user)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+// GetAll lists the users whose email and username contain the given
+// strings, optionally only those with the given activation state.
+func (u UserModel) GetAll(email string, username string, activated *bool, filters Filters) ([]*User, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), %s
+		FROM users
+		WHERE (users.email ILIKE '%%' || $1 || '%%' OR $1 = '')
+		AND (users.username ILIKE '%%' || $2 || '%%' OR $2 = '')
+		AND (users.activated = $3 OR $3 IS NULL)
+		ORDER BY %s
+		LIMIT $4 OFFSET $5
+	`, userColumns, filters.sortOrder("users", false))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := u.DB.QueryContext(ctx, query, email, username, activated, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	users := []*User{}
+
+	for rows.Next() {
+		var user User
+
+		err := rows.Scan(&totalRecords, &user.ID, &user.CreatedAt, &user.Username, &user.Email, &user.Password.hash, &user.Activated,
+			&user.Disabled, &user.NotifyMentions, &user.Language, &user.Version)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		users = append(users, &user)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return users, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+}
+
+// SetDisabled deactivates or reactivates the user's account. A deactivated
+// user cannot sign in or use any token they already hold.
+func (u UserModel) SetDisabled(user *User, disabled bool) error {
+	query := `
+		UPDATE users
+		SET disabled_at = CASE WHEN $2 THEN COALESCE(disabled_at, NOW()) END, version = version + 1
+		WHERE id = $1
+		RETURNING version
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := u.DB.QueryRowContext(ctx, query, user.ID, disabled).Scan(&user.Version)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	user.Disabled = disabled
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package diff
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	OpEqual  = "equal"
+	OpInsert = "insert"
+	OpDelete = "delete"
+)
+
+var wordRX = regexp.MustCompile(`\s+|\S+`)
+
+type Change struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// Lines returns the changes needed to turn a into b, compared line by line.
+func Lines(a string, b string) []Change {
+	return compute(strings.SplitAfter(a, "\n"), strings.SplitAfter(b, "\n"))
+}
+
+// Words returns the changes needed to turn a into b, compared word by word.
+// Runs of whitespace are kept as tokens of their own so that the text of the
+// changes reassembles into the original strings.
+func Words(a string, b string) []Change {
+	return compute(wordRX.FindAllString(a, -1), wordRX.FindAllString(b, -1))
+}
+
+// compute diffs two token sequences using their longest common subsequence.
+// Comments are short, so the quadratic table is not a concern.
+func compute(a []string, b []string) []Change {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	changes := []Change{}
+	i, j := 0, 0
+
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			changes = appendChange(changes, OpEqual, a[i])
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			changes = appendChange(changes, OpDelete, a[i])
+			i++
+		default:
+			changes = appendChange(changes, OpInsert, b[j])
+			j++
+		}
+	}
+
+	return changes
+}
+
+func appendChange(changes []Change, op string, text string) []Change {
+	if text == "" {
+		return changes
+	}
+
+	last := len(changes) - 1
+	if last >= 0 && changes[last].Op == op {
+		changes[last].Text += text
+		return changes
+	}
+
+	return append(changes, Change{Op: op, Text: text})
+}
@@ -0,0 +1,110 @@
+package diff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWords(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want []Change
+	}{
+		{
+			name: "identical",
+			a:    "the same text",
+			b:    "the same text",
+			want: []Change{{OpEqual, "the same text"}},
+		},
+		{
+			name: "replaced word",
+			a:    "a quick fox",
+			b:    "a slow fox",
+			want: []Change{{OpEqual, "a "}, {OpDelete, "quick"}, {OpInsert, "slow"}, {OpEqual, " fox"}},
+		},
+		{
+			name: "appended words",
+			a:    "hello",
+			b:    "hello there world",
+			want: []Change{{OpEqual, "hello"}, {OpInsert, " there world"}},
+		},
+		{
+			name: "from empty",
+			a:    "",
+			b:    "new",
+			want: []Change{{OpInsert, "new"}},
+		},
+		{
+			name: "to empty",
+			a:    "gone",
+			b:    "",
+			want: []Change{{OpDelete, "gone"}},
+		},
+		{
+			name: "both empty",
+			want: []Change{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Words(tt.a, tt.b)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Words(%q, %q) = %v; want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLines(t *testing.T) {
+	a := "first\nsecond\nthird\n"
+	b := "first\n2nd\nthird\nfourth"
+
+	want := []Change{
+		{OpEqual, "first\n"},
+		{OpDelete, "second\n"},
+		{OpInsert, "2nd\n"},
+		{OpEqual, "third\n"},
+		{OpInsert, "fourth"},
+	}
+
+	got := Lines(a, b)
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Lines(%q, %q) = %v; want %v", a, b, got, want)
+	}
+}
+
+// The changes must reassemble into both texts, whitespace included, so that
+// a client can render either side of the diff from it.
+func TestChangesReassemble(t *testing.T) {
+	pairs := [][2]string{
+		{"one  two\tthree\n", "one two  three"},
+		{"line one\nline two\n", "line two\nline three\n"},
+		{"  leading and trailing  ", "leading and trailing"},
+	}
+
+	for _, pair := range pairs {
+		for name, fn := range map[string]func(string, string) []Change{"Words": Words, "Lines": Lines} {
+			var before, after strings.Builder
+
+			for _, change := range fn(pair[0], pair[1]) {
+				if change.Op != OpInsert {
+					before.WriteString(change.Text)
+				}
+
+				if change.Op != OpDelete {
+					after.WriteString(change.Text)
+				}
+			}
+
+			if before.String() != pair[0] || after.String() != pair[1] {
+				t.Errorf("%s(%q, %q) reassembles into %q and %q", name, pair[0], pair[1], before.String(), after.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package filter
+
+import (
+	"math"
+	"strings"
+	"sync"
+)
+
+// minTrainingExamples is how many examples of each class the classifier
+// must have seen before its scores are trusted.
+const minTrainingExamples = 10
+
+// Classifier is a multinomial naive-Bayes spam classifier. It is trained on
+// the site's own moderation decisions, rejected comments as spam and
+// approved ones as ham, and is safe for concurrent use.
+type Classifier struct {
+	mu     sync.RWMutex
+	docs   [2]int
+	totals [2]int
+	counts map[string]*[2]int
+}
+
+const (
+	ham  = 0
+	spam = 1
+)
+
+func NewClassifier() *Classifier {
+	return &Classifier{counts: make(map[string]*[2]int)}
+}
+
+func (c *Classifier) Train(text string, isSpam bool) {
+	class := ham
+	if isSpam {
+		class = spam
+	}
+
+	tokens := tokenize(text)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.docs[class]++
+	for _, token := range tokens {
+		count, found := c.counts[token]
+		if !found {
+			count = &[2]int{}
+			c.counts[token] = count
+		}
+		count[class]++
+		c.totals[class]++
+	}
+}
+
+// SpamProbability returns the probability that text is spam. The second
+// result is false while the classifier has too little training to judge.
+func (c *Classifier) SpamProbability(text string) (float64, bool) {
+	tokens := tokenize(text)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.docs[ham] < minTrainingExamples || c.docs[spam] < minTrainingExamples {
+		return 0, false
+	}
+
+	// Work in log space to avoid underflow, with Laplace smoothing for
+	// tokens not seen in a class.
+	vocabulary := float64(len(c.counts))
+	var logs [2]float64
+
+	for class := range logs {
+		logs[class] = math.Log(float64(c.docs[class]) / float64(c.docs[ham]+c.docs[spam]))
+
+		for _, token := range tokens {
+			seen := 0
+			if count, found := c.counts[token]; found {
+				seen = count[class]
+			}
+			logs[class] += math.Log((float64(seen) + 1) / (float64(c.totals[class]) + vocabulary))
+		}
+	}
+
+	return 1 / (1 + math.Exp(logs[ham]-logs[spam])), true
+}
+
+func tokenize(text string) []string {
+	tokens := strings.Fields(Normalise(text))
+
+	// Links are normalised away, but how many a comment has is a strong
+	// signal, so each one counts as a token of its own.
+	for range linkRX.FindAllStringIndex(text, -1) {
+		tokens = append(tokens, "__link__")
+	}
+
+	return tokens
+}
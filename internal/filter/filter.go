@@ -0,0 +1,76 @@
+package filter
+
+import "fmt"
+
+// Verdict is a stage's decision on a submission. Verdicts are ordered by
+// severity, so the pipeline's verdict is the most severe of its stages'.
+type Verdict int
+
+const (
+	Allow Verdict = iota
+	Hold
+	Reject
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case Allow:
+		return "allow"
+	case Hold:
+		return "hold"
+	case Reject:
+		return "reject"
+	default:
+		return fmt.Sprintf("verdict(%d)", int(v))
+	}
+}
+
+// Submission is a comment body to be checked. CommentID is zero for new
+// comments and set when an existing comment is being edited.
+type Submission struct {
+	CommentID int64
+	UserID    int64
+	Content   string
+}
+
+type Result struct {
+	Verdict Verdict
+	Stage   string
+	Reason  string
+}
+
+type Stage interface {
+	Name() string
+	Check(submission Submission) (Verdict, string, error)
+}
+
+type Pipeline struct {
+	stages []Stage
+}
+
+func New(stages ...Stage) *Pipeline {
+	return &Pipeline{stages: stages}
+}
+
+// Run passes the submission through each stage in turn and returns the most
+// severe verdict, stopping early at the first rejection.
+func (p *Pipeline) Run(submission Submission) (Result, error) {
+	result := Result{Verdict: Allow}
+
+	for _, stage := range p.stages {
+		verdict, reason, err := stage.Check(submission)
+		if err != nil {
+			return Result{}, fmt.Errorf("%s filter: %w", stage.Name(), err)
+		}
+
+		if verdict > result.Verdict {
+			result = Result{Verdict: verdict, Stage: stage.Name(), Reason: reason}
+		}
+
+		if result.Verdict == Reject {
+			break
+		}
+	}
+
+	return result, nil
+}
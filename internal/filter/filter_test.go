@@ -0,0 +1,166 @@
+package filter
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixedStage returns the same verdict for every submission and counts how
+// often it is called.
+type fixedStage struct {
+	name    string
+	verdict Verdict
+	err     error
+	calls   int
+}
+
+func (f *fixedStage) Name() string {
+	return f.name
+}
+
+func (f *fixedStage) Check(submission Submission) (Verdict, string, error) {
+	f.calls++
+	return f.verdict, f.name + " reason", f.err
+}
+
+func TestPipelineRun(t *testing.T) {
+	allow := &fixedStage{name: "allow", verdict: Allow}
+	hold := &fixedStage{name: "hold", verdict: Hold}
+	reject := &fixedStage{name: "reject", verdict: Reject}
+	after := &fixedStage{name: "after", verdict: Hold}
+
+	result, err := New(allow, hold, reject, after).Run(Submission{Content: "text"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Verdict != Reject || result.Stage != "reject" || result.Reason != "reject reason" {
+		t.Errorf("got %+v; want the rejecting stage's result", result)
+	}
+
+	if after.calls != 0 {
+		t.Errorf("stage after a rejection ran %d times", after.calls)
+	}
+}
+
+func TestPipelineRunKeepsMostSevere(t *testing.T) {
+	result, err := New(
+		&fixedStage{name: "first", verdict: Hold},
+		&fixedStage{name: "second", verdict: Hold},
+		&fixedStage{name: "third", verdict: Allow},
+	).Run(Submission{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Verdict != Hold || result.Stage != "first" {
+		t.Errorf("got %+v; want the first hold", result)
+	}
+}
+
+func TestPipelineRunError(t *testing.T) {
+	_, err := New(&fixedStage{name: "broken", err: errors.New("boom")}).Run(Submission{})
+	if err == nil || !strings.Contains(err.Error(), "broken filter") {
+		t.Errorf("got %v; want an error naming the stage", err)
+	}
+}
+
+func TestBannedWords(t *testing.T) {
+	stage := NewBannedWords([]string{"spam"})
+
+	tests := map[string]Verdict{
+		"perfectly fine comment": Allow,
+		"buy spam now":           Reject,
+		"buy SP4M now":           Reject,
+		"buy s.p.a.m now":        Reject,
+		"buy s p a m now":        Reject,
+		"buy spaaam now":         Reject,
+		"buy ѕраm now":           Reject,
+		"spammer":                Allow,
+	}
+
+	for content, want := range tests {
+		got, _, err := stage.Check(Submission{Content: content})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got != want {
+			t.Errorf("%q: got %s; want %s", content, got, want)
+		}
+	}
+}
+
+func TestLinkLimit(t *testing.T) {
+	stage := &LinkLimit{Max: 1}
+
+	tests := map[string]Verdict{
+		"no links":                Allow,
+		"one https://example.com": Allow,
+		"two https://a.example and www.b.example":   Hold,
+		"three http://a.io http://b.io http://c.io": Hold,
+	}
+
+	for content, want := range tests {
+		got, _, _ := stage.Check(Submission{Content: content})
+		if got != want {
+			t.Errorf("%q: got %s; want %s", content, got, want)
+		}
+	}
+}
+
+func TestDuplicate(t *testing.T) {
+	var lookups int
+
+	stage := &Duplicate{
+		Window: time.Hour,
+		Lookup: func(userID int64, content string, excludeID int64, window time.Duration) (bool, error) {
+			lookups++
+			return content == "seen before", nil
+		},
+	}
+
+	got, _, _ := stage.Check(Submission{UserID: 1, Content: "seen before"})
+	if got != Reject {
+		t.Errorf("got %s for a duplicate; want reject", got)
+	}
+
+	got, _, _ = stage.Check(Submission{UserID: 1, Content: "new"})
+	if got != Allow {
+		t.Errorf("got %s for new content; want allow", got)
+	}
+
+	got, _, _ = stage.Check(Submission{Content: "seen before"})
+	if got != Allow || lookups != 2 {
+		t.Errorf("anonymous submission: got %s after %d lookups; want allow without a lookup", got, lookups)
+	}
+}
+
+func TestSpamClassifier(t *testing.T) {
+	classifier := NewClassifier()
+	stage := &SpamClassifier{Classifier: classifier, Threshold: 0.9}
+
+	spamText := "cheap pills buy now http://pills.example"
+
+	got, _, _ := stage.Check(Submission{Content: spamText})
+	if got != Allow {
+		t.Errorf("untrained classifier: got %s; want allow", got)
+	}
+
+	for i := 0; i < minTrainingExamples; i++ {
+		classifier.Train("cheap pills discount buy now http://pills.example", true)
+		classifier.Train("great article, thanks for writing it up", false)
+	}
+
+	got, _, _ = stage.Check(Submission{Content: spamText})
+	if got != Hold {
+		t.Errorf("spam: got %s; want hold", got)
+	}
+
+	got, _, _ = stage.Check(Submission{Content: "thanks, great write up"})
+	if got != Allow {
+		t.Errorf("ham: got %s; want allow", got)
+	}
+}
@@ -0,0 +1,97 @@
+package filter
+
+import (
+	"strings"
+	"unicode"
+)
+
+// confusables maps characters that are commonly substituted for Latin
+// letters, whether look-alikes from other scripts, accented forms or
+// leetspeak digits and symbols, to the letter they stand in for.
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o',
+	'р': 'p', 'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'і': 'i', 'ї': 'i', 'ј': 'j',
+	'ѕ': 's', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o',
+	'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x',
+	// Latin with diacritics
+	'à': 'a', 'á': 'a', 'â': 'a', 'ã': 'a', 'ä': 'a', 'å': 'a', 'ç': 'c', 'è': 'e',
+	'é': 'e', 'ê': 'e', 'ë': 'e', 'ì': 'i', 'í': 'i', 'î': 'i', 'ï': 'i', 'ñ': 'n',
+	'ò': 'o', 'ó': 'o', 'ô': 'o', 'õ': 'o', 'ö': 'o', 'ø': 'o', 'ù': 'u', 'ú': 'u',
+	'û': 'u', 'ü': 'u', 'ý': 'y', 'ÿ': 'y', 'ı': 'i', 'ɡ': 'g',
+	// Leetspeak
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b', '9': 'g',
+	'@': 'a', '$': 's', '!': 'i', '|': 'l', '+': 't',
+}
+
+// Normalise folds text to lower-case ASCII letters separated by single
+// spaces, undoing the usual tricks for dodging word filters: look-alike
+// characters, leetspeak and letters spaced out with punctuation.
+func Normalise(text string) string {
+	var b strings.Builder
+
+	for _, r := range strings.ToLower(text) {
+		// Fullwidth forms sit at a fixed offset from their ASCII
+		// equivalents.
+		if r >= '！' && r <= '～' {
+			r = r - '！' + '!'
+		}
+
+		if replacement, found := confusables[r]; found {
+			r = replacement
+		}
+
+		switch {
+		case r >= 'a' && r <= 'z':
+			b.WriteRune(r)
+		case unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r):
+			b.WriteRune(' ')
+		}
+	}
+
+	return strings.Join(joinSpacedLetters(strings.Fields(b.String())), " ")
+}
+
+// joinSpacedLetters merges runs of single-letter words, so that "b a d"
+// and "b.a.d" are both seen as "bad".
+func joinSpacedLetters(words []string) []string {
+	joined := make([]string, 0, len(words))
+	run := ""
+
+	for _, word := range words {
+		if len(word) == 1 {
+			run += word
+			continue
+		}
+
+		if run != "" {
+			joined = append(joined, run)
+			run = ""
+		}
+
+		joined = append(joined, word)
+	}
+
+	if run != "" {
+		joined = append(joined, run)
+	}
+
+	return joined
+}
+
+// squeeze collapses repeated letters, so that "baaad" matches "bad".
+func squeeze(word string) string {
+	var b strings.Builder
+
+	var last rune
+	for _, r := range word {
+		if r != last {
+			b.WriteRune(r)
+		}
+		last = r
+	}
+
+	return b.String()
+}
@@ -0,0 +1,120 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// BannedWords rejects content containing any of a list of words, matched
+// after normalisation so that "Sp4m", "s.p.a.m" and "spaaam" all count.
+type BannedWords struct {
+	words map[string]struct{}
+}
+
+func NewBannedWords(words []string) *BannedWords {
+	b := &BannedWords{words: make(map[string]struct{}, len(words))}
+
+	for _, word := range words {
+		word = strings.ReplaceAll(Normalise(word), " ", "")
+		if word != "" {
+			b.words[word] = struct{}{}
+			b.words[squeeze(word)] = struct{}{}
+		}
+	}
+
+	return b
+}
+
+func (b *BannedWords) Name() string {
+	return "banned_words"
+}
+
+func (b *BannedWords) Check(submission Submission) (Verdict, string, error) {
+	for _, word := range strings.Fields(Normalise(submission.Content)) {
+		_, found := b.words[word]
+		if !found {
+			_, found = b.words[squeeze(word)]
+		}
+
+		if found {
+			return Reject, "contains a banned word", nil
+		}
+	}
+
+	return Allow, "", nil
+}
+
+var linkRX = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+
+// LinkLimit holds content with more than Max links for a moderator to look
+// at, since link spam is the most common kind.
+type LinkLimit struct {
+	Max int
+}
+
+func (l *LinkLimit) Name() string {
+	return "link_limit"
+}
+
+func (l *LinkLimit) Check(submission Submission) (Verdict, string, error) {
+	count := len(linkRX.FindAllStringIndex(submission.Content, -1))
+	if count > l.Max {
+		return Hold, fmt.Sprintf("contains %d links, more than the %d allowed", count, l.Max), nil
+	}
+
+	return Allow, "", nil
+}
+
+// DuplicateLookup reports whether the user has posted the same content,
+// other than in the comment being edited, within the window.
+type DuplicateLookup func(userID int64, content string, excludeID int64, window time.Duration) (bool, error)
+
+// Duplicate rejects content the same user has already posted recently.
+// Anonymous submissions are not checked.
+type Duplicate struct {
+	Lookup DuplicateLookup
+	Window time.Duration
+}
+
+func (d *Duplicate) Name() string {
+	return "duplicate"
+}
+
+func (d *Duplicate) Check(submission Submission) (Verdict, string, error) {
+	if submission.UserID == 0 {
+		return Allow, "", nil
+	}
+
+	found, err := d.Lookup(submission.UserID, submission.Content, submission.CommentID, d.Window)
+	if err != nil {
+		return Allow, "", err
+	}
+
+	if found {
+		return Reject, "duplicates a recent comment", nil
+	}
+
+	return Allow, "", nil
+}
+
+// SpamClassifier holds content the classifier rates as spam with at least
+// the given probability.
+type SpamClassifier struct {
+	Classifier *Classifier
+	Threshold  float64
+}
+
+func (s *SpamClassifier) Name() string {
+	return "spam_classifier"
+}
+
+func (s *SpamClassifier) Check(submission Submission) (Verdict, string, error) {
+	probability, ok := s.Classifier.SpamProbability(submission.Content)
+	if ok && probability >= s.Threshold {
+		return Hold, fmt.Sprintf("looks like spam (%.0f%%)", probability*100), nil
+	}
+
+	return Allow, "", nil
+}
@@ -3,31 +3,49 @@ package mailer
 import (
 	"bytes"
 	"embed"
+	"fmt"
 	"html/template"
-	"time"
-
-	"github.com/go-mail/mail/v2"
+	"io/fs"
+	"os"
+	"strings"
 )
 
+//go:embed "templates"
 var templateFS embed.FS
 
 type Mailer struct {
-	dailer *mail.Dialer
-	sender string
+	transport Transport
+	sender    string
+	templates []fs.FS
 }
 
-func New(host string, port int, username string, password string, sender string) Mailer {
-	dailer := mail.NewDialer(host, port, username, password)
-	dailer.Timeout = 5 * time.Second
+// New returns a Mailer delivering through transport. Templates are looked
+// up in templateDir first, when it is set, so that any of the embedded
+// templates can be overridden without rebuilding.
+func New(transport Transport, sender string, templateDir string) Mailer {
+	embedded, err := fs.Sub(templateFS, "templates")
+	if err != nil {
+		panic(err)
+	}
+
+	templates := []fs.FS{embedded}
+	if templateDir != "" {
+		templates = append([]fs.FS{os.DirFS(templateDir)}, templates...)
+	}
 
 	return Mailer{
-		dailer: dailer,
-		sender: sender,
+		transport: transport,
+		sender:    sender,
+		templates: templates,
 	}
 }
 
-func (m Mailer) Send(recipient string, tmplFile string, data any) error {
-	tmpl, err := template.New("email").ParseFS(templateFS, "/templates/"+tmplFile)
+// Send renders tmplFile in the recipient's locale and delivers it. A
+// translation such as user_welcome.es.tmpl is used when there is one for
+// the locale, or for its language when the locale names a region, falling
+// back to the untranslated template.
+func (m Mailer) Send(recipient string, locale string, tmplFile string, data any) error {
+	tmpl, err := m.parse(locale, tmplFile)
 	if err != nil {
 		return err
 	}
@@ -50,21 +68,50 @@ func (m Mailer) Send(recipient string, tmplFile string, data any) error {
 		return err
 	}
 
-	msg := mail.NewMessage()
-	msg.SetHeader("To", recipient)
-	msg.SetHeader("From", m.sender)
-	msg.SetHeader("Subject", subject.String())
-	msg.SetBody("text/plain", plainBody.String())
-	msg.AddAlternative("text/html", htmlBody.String())
-
-	for i := 1; i <= 3; i++ {
-		err = m.dailer.DialAndSend(msg)
-		if err == nil {
-			return nil
+	msg := Message{
+		From:      m.sender,
+		To:        recipient,
+		Subject:   subject.String(),
+		PlainBody: plainBody.String(),
+		HTMLBody:  htmlBody.String(),
+	}
+
+	// Emails that carry an unsubscribe link advertise it in the headers too,
+	// so that mail clients can offer their own unsubscribe button.
+	if values, ok := data.(map[string]any); ok {
+		if unsubscribeURL, ok := values["unsubscribeURL"].(string); ok {
+			msg.ListUnsubscribe = unsubscribeURL
 		}
+	}
 
-		time.Sleep(500 * time.Millisecond)
+	// Failed sends are retried, with backoff, by the outbox that called us.
+	return m.transport.Deliver(msg)
+}
+
+func (m Mailer) parse(locale string, tmplFile string) (*template.Template, error) {
+	base := strings.TrimSuffix(tmplFile, ".tmpl")
+
+	candidates := []string{}
+	if locale != "" {
+		candidates = append(candidates, base+"."+locale+".tmpl")
+
+		language, _, found := strings.Cut(locale, "-")
+		if found {
+			candidates = append(candidates, base+"."+language+".tmpl")
+		}
+	}
+	candidates = append(candidates, tmplFile)
+
+	for _, name := range candidates {
+		for _, templates := range m.templates {
+			_, err := fs.Stat(templates, name)
+			if err != nil {
+				continue
+			}
+
+			return template.New("email").ParseFS(templates, name)
+		}
 	}
 
-	return err
+	return nil, fmt.Errorf("mailer: template %q not found", tmplFile)
 }
@@ -0,0 +1,108 @@
+package mailer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSendLocaleFallback(t *testing.T) {
+	tests := []struct {
+		name    string
+		locale  string
+		subject string
+	}{
+		{"exact locale", "es", "¡Bienvenido a Comments Community!"},
+		{"language of regional locale", "es-MX", "¡Bienvenido a Comments Community!"},
+		{"untranslated locale", "fr", "Welcome to the Comments Community!"},
+		{"no locale", "", "Welcome to the Comments Community!"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &MemoryTransport{}
+			m := New(transport, "sender@example.com", "")
+
+			err := m.Send("alice@example.com", tt.locale, "user_welcome.tmpl", map[string]any{
+				"activationToken": "TOKEN",
+				"userID":          1,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			messages := transport.Messages()
+			if len(messages) != 1 {
+				t.Fatalf("got %d messages; want 1", len(messages))
+			}
+
+			if messages[0].Subject != tt.subject {
+				t.Errorf("got subject %q; want %q", messages[0].Subject, tt.subject)
+			}
+
+			if !strings.Contains(messages[0].PlainBody, "TOKEN") {
+				t.Errorf("plain body is missing the token: %q", messages[0].PlainBody)
+			}
+		})
+	}
+}
+
+func TestSendTemplateOverride(t *testing.T) {
+	dir := t.TempDir()
+
+	override := `{{define "subject"}}Overridden{{end}}{{define "plainBody"}}plain{{end}}{{define "htmlBody"}}html{{end}}`
+
+	err := os.WriteFile(filepath.Join(dir, "user_welcome.tmpl"), []byte(override), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transport := &MemoryTransport{}
+	m := New(transport, "sender@example.com", dir)
+
+	// The override has no Spanish version, but the embedded templates do,
+	// and a translation is preferred wherever it comes from.
+	for locale, subject := range map[string]string{"en": "Overridden", "es": "¡Bienvenido a Comments Community!"} {
+		transport.Reset()
+
+		err = m.Send("alice@example.com", locale, "user_welcome.tmpl", map[string]any{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := transport.Messages()[0].Subject; got != subject {
+			t.Errorf("locale %q: got subject %q; want %q", locale, got, subject)
+		}
+	}
+}
+
+func TestSendUnknownTemplate(t *testing.T) {
+	m := New(&MemoryTransport{}, "sender@example.com", "")
+
+	err := m.Send("alice@example.com", "en", "missing.tmpl", nil)
+	if err == nil {
+		t.Fatal("expected an error for a missing template")
+	}
+}
+
+func TestSendListUnsubscribe(t *testing.T) {
+	transport := &MemoryTransport{}
+	m := New(transport, "sender@example.com", "")
+
+	err := m.Send("alice@example.com", "en", "comment_notification.tmpl", map[string]any{
+		"username":       "alice",
+		"author":         "bob",
+		"content":        "hello",
+		"commentID":      1,
+		"threadKey":      "thread",
+		"unsubscribeURL": "https://example.com/unsubscribe",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := transport.Messages()[0].ListUnsubscribe; got != "https://example.com/unsubscribe" {
+		t.Errorf("got List-Unsubscribe %q", got)
+	}
+}
@@ -0,0 +1,139 @@
+package mailer
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/go-mail/mail/v2"
+)
+
+const (
+	TransportSMTP = "smtp"
+	TransportFile = "file"
+	TransportLog  = "log"
+)
+
+var Transports = []string{TransportSMTP, TransportFile, TransportLog}
+
+// Message is a rendered email, ready to be delivered by a Transport.
+// ListUnsubscribe, when set, is a one-click unsubscribe URL that mail
+// clients may POST to (RFC 8058).
+type Message struct {
+	From            string
+	To              string
+	Subject         string
+	PlainBody       string
+	HTMLBody        string
+	ListUnsubscribe string
+}
+
+func (m Message) build() *mail.Message {
+	msg := mail.NewMessage()
+	msg.SetHeader("To", m.To)
+	msg.SetHeader("From", m.From)
+	msg.SetHeader("Subject", m.Subject)
+	if m.ListUnsubscribe != "" {
+		msg.SetHeader("List-Unsubscribe", "<"+m.ListUnsubscribe+">")
+		msg.SetHeader("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+	}
+	msg.SetBody("text/plain", m.PlainBody)
+	msg.AddAlternative("text/html", m.HTMLBody)
+
+	return msg
+}
+
+// Transport delivers rendered messages.
+type Transport interface {
+	Deliver(msg Message) error
+}
+
+// SMTPTransport delivers messages through an SMTP server.
+type SMTPTransport struct {
+	dialer *mail.Dialer
+}
+
+func NewSMTPTransport(host string, port int, username string, password string) *SMTPTransport {
+	dialer := mail.NewDialer(host, port, username, password)
+	dialer.Timeout = 5 * time.Second
+
+	return &SMTPTransport{dialer: dialer}
+}
+
+func (t *SMTPTransport) Deliver(msg Message) error {
+	return t.dialer.DialAndSend(msg.build())
+}
+
+var unsafeFilenameRX = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// FileTransport writes each message to its own .eml file in Dir, where it
+// can be opened with any mail client.
+type FileTransport struct {
+	Dir string
+}
+
+func (t *FileTransport) Deliver(msg Message) error {
+	err := os.MkdirAll(t.Dir, 0o755)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), unsafeFilenameRX.ReplaceAllString(msg.To, "_"))
+
+	file, err := os.Create(filepath.Join(t.Dir, name))
+	if err != nil {
+		return err
+	}
+
+	_, err = msg.build().WriteTo(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// LogTransport logs each message instead of sending it. Bodies are left out
+// as they often hold tokens; use FileTransport to read them.
+type LogTransport struct {
+	Logger *slog.Logger
+}
+
+func (t *LogTransport) Deliver(msg Message) error {
+	t.Logger.Info("email", "from", msg.From, "to", msg.To, "subject", msg.Subject)
+	return nil
+}
+
+// MemoryTransport keeps every message it is given, for tests to inspect.
+type MemoryTransport struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (t *MemoryTransport) Deliver(msg Message) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.messages = append(t.messages, msg)
+	return nil
+}
+
+// Messages returns the messages delivered so far, oldest first.
+func (t *MemoryTransport) Messages() []Message {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]Message(nil), t.messages...)
+}
+
+func (t *MemoryTransport) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.messages = nil
+}
@@ -0,0 +1,84 @@
+// Package markup renders comment bodies to HTML that is safe to insert into
+// a page as is.
+package markup
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+const (
+	Plain    = "plain"
+	Markdown = "markdown"
+)
+
+var Formats = []string{Plain, Markdown}
+
+// linkRel marks links as user-generated, so that search engines do not
+// credit the sites commenters link to.
+const linkRel = "nofollow ugc"
+
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.Linkify),
+	goldmark.WithParserOptions(
+		parser.WithASTTransformers(util.Prioritized(linkTransformer{}, 100)),
+	),
+)
+
+// policy allows the handful of elements that basic formatting needs. Raw
+// HTML in the source is already dropped by goldmark, so this is a second
+// line of defence rather than the first.
+var policy = func() *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+	p.AllowElements("p", "br", "strong", "em", "code", "pre", "blockquote", "ul", "ol", "li")
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowAttrs("rel").Matching(regexp.MustCompile(`^` + linkRel + `$`)).OnElements("a")
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.RequireParseableURLs(true)
+	return p
+}()
+
+// Render returns the sanitised HTML for source written in format. Plain text
+// is escaped, with its line breaks kept.
+func Render(format string, source string) (string, error) {
+	if format != Markdown {
+		escaped := html.EscapeString(source)
+		return "<p>" + strings.ReplaceAll(escaped, "\n", "<br>") + "</p>", nil
+	}
+
+	var buf bytes.Buffer
+
+	err := markdown.Convert([]byte(source), &buf)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(policy.Sanitize(buf.String())), nil
+}
+
+type linkTransformer struct{}
+
+func (linkTransformer) Transform(document *ast.Document, reader text.Reader, pc parser.Context) {
+	ast.Walk(document, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch node.Kind() {
+		case ast.KindLink, ast.KindAutoLink:
+			node.SetAttributeString("rel", []byte(linkRel))
+		}
+
+		return ast.WalkContinue, nil
+	})
+}
@@ -0,0 +1,84 @@
+package markup
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		contains []string
+		excludes []string
+	}{
+		{
+			name:     "emphasis",
+			source:   "some **bold** and *italic* text",
+			contains: []string{"<strong>bold</strong>", "<em>italic</em>"},
+		},
+		{
+			name:     "links get nofollow",
+			source:   "[site](https://example.com)",
+			contains: []string{`href="https://example.com"`, `rel="nofollow ugc"`},
+		},
+		{
+			name:     "bare links are linkified",
+			source:   "see https://example.com now",
+			contains: []string{`<a href="https://example.com"`},
+		},
+		{
+			name:     "inline script is stripped",
+			source:   "hello <script>alert(1)</script> world",
+			excludes: []string{"<script", "alert(1)</script>"},
+		},
+		{
+			name:     "javascript urls are dropped",
+			source:   "[click](javascript:alert(1))",
+			excludes: []string{"javascript:"},
+		},
+		{
+			name:     "event handlers are stripped",
+			source:   `<a href="https://example.com" onclick="steal()">x</a>`,
+			excludes: []string{"onclick", "steal()"},
+		},
+		{
+			name:     "images are not allowed",
+			source:   "![alt](https://example.com/a.png)",
+			excludes: []string{"<img"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			html, err := Render(Markdown, tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, want := range tt.contains {
+				if !strings.Contains(html, want) {
+					t.Errorf("%q does not contain %q", html, want)
+				}
+			}
+
+			for _, unwanted := range tt.excludes {
+				if strings.Contains(html, unwanted) {
+					t.Errorf("%q contains %q", html, unwanted)
+				}
+			}
+		})
+	}
+}
+
+func TestRenderPlain(t *testing.T) {
+	html, err := Render(Plain, "<b>hi</b>\nthere & **not bold**")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "<p>&lt;b&gt;hi&lt;/b&gt;<br>there &amp; **not bold**</p>"
+	if html != want {
+		t.Errorf("got %q; want %q", html, want)
+	}
+}
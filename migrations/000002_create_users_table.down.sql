@@ -1,9 +1 @@
-CREATE TABLE IF NOT EXISTS users (
-    id bigserial PRIMARY KEY,
-    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
-    username text NOT NULL,
-    email citext UNIQUE NOT NULL,
-    password_hash bytea NOT NULL,
-    activated bool NOT NULL,
-    version integer NOT NULL DEFAULT 1
-);
\ No newline at end of file
+DROP TABLE IF EXISTS users;
\ No newline at end of file
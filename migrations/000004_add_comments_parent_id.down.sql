@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS comments_parent_id_idx;
+
+ALTER TABLE comments DROP COLUMN IF EXISTS parent_id;
\ No newline at end of file
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS comments_thread_id_idx;
+
+ALTER TABLE comments DROP COLUMN IF EXISTS thread_id;
+
+DROP TABLE IF EXISTS threads;
\ No newline at end of file
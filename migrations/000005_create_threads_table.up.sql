@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS threads (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    key text UNIQUE NOT NULL
+);
+
+INSERT INTO threads (key) VALUES ('default') ON CONFLICT (key) DO NOTHING;
+
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS thread_id bigint REFERENCES threads ON DELETE CASCADE;
+
+UPDATE comments SET thread_id = (SELECT id FROM threads WHERE key = 'default') WHERE thread_id IS NULL;
+
+ALTER TABLE comments ALTER COLUMN thread_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS comments_thread_id_idx ON comments (thread_id);
\ No newline at end of file
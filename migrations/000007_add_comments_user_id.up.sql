@@ -0,0 +1,3 @@
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS user_id bigint REFERENCES users ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS comments_user_id_idx ON comments (user_id);
\ No newline at end of file
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS comment_revisions (
+    id bigserial PRIMARY KEY,
+    comment_id bigint NOT NULL REFERENCES comments ON DELETE CASCADE,
+    version integer NOT NULL,
+    content text NOT NULL,
+    author text NOT NULL,
+    editor_id bigint REFERENCES users ON DELETE SET NULL,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    UNIQUE (comment_id, version)
+);
\ No newline at end of file
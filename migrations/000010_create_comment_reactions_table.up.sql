@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS comment_reactions (
+    comment_id bigint NOT NULL REFERENCES comments ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    kind text NOT NULL,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (comment_id, user_id, kind)
+);
+
+CREATE INDEX IF NOT EXISTS comment_reactions_user_id_idx ON comment_reactions (user_id);
\ No newline at end of file
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS comments_score_id_idx;
+
+DROP INDEX IF EXISTS comments_created_at_id_idx;
+
+ALTER TABLE comments DROP COLUMN IF EXISTS score;
\ No newline at end of file
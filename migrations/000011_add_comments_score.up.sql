@@ -0,0 +1,11 @@
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS score integer NOT NULL DEFAULT 0;
+
+UPDATE comments SET score = (
+    SELECT COALESCE(SUM(CASE kind WHEN 'upvote' THEN 1 WHEN 'downvote' THEN -1 ELSE 0 END), 0)
+    FROM comment_reactions
+    WHERE comment_reactions.comment_id = comments.id
+);
+
+CREATE INDEX IF NOT EXISTS comments_created_at_id_idx ON comments (created_at, id);
+
+CREATE INDEX IF NOT EXISTS comments_score_id_idx ON comments (score, id);
\ No newline at end of file
@@ -0,0 +1,11 @@
+ALTER TABLE threads DROP COLUMN IF EXISTS moderation;
+
+DROP INDEX IF EXISTS comments_pending_idx;
+
+ALTER TABLE comments DROP COLUMN IF EXISTS moderated_at;
+
+ALTER TABLE comments DROP COLUMN IF EXISTS moderated_by;
+
+ALTER TABLE comments DROP COLUMN IF EXISTS moderation_reason;
+
+ALTER TABLE comments DROP COLUMN IF EXISTS status;
\ No newline at end of file
@@ -0,0 +1,11 @@
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'approved' CHECK (status IN ('pending', 'approved', 'rejected'));
+
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS moderation_reason text;
+
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS moderated_by bigint REFERENCES users ON DELETE SET NULL;
+
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS moderated_at timestamp(0) WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS comments_pending_idx ON comments (id) WHERE status = 'pending';
+
+ALTER TABLE threads ADD COLUMN IF NOT EXISTS moderation text CHECK (moderation IN ('all', 'first-time', 'none'));
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS comment_reports;
\ No newline at end of file
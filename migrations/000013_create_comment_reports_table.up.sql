@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS comment_reports (
+    id bigserial PRIMARY KEY,
+    comment_id bigint NOT NULL REFERENCES comments ON DELETE CASCADE,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    reason text NOT NULL,
+    note text NOT NULL DEFAULT '',
+    status text NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'resolved', 'dismissed')),
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    closed_by bigint REFERENCES users ON DELETE SET NULL,
+    closed_at timestamp(0) WITH TIME ZONE,
+    UNIQUE (comment_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS comment_reports_open_idx ON comment_reports (comment_id) WHERE status = 'open';
\ No newline at end of file
@@ -0,0 +1,3 @@
+ALTER TABLE comment_revisions DROP COLUMN IF EXISTS format;
+
+ALTER TABLE comments DROP COLUMN IF EXISTS format;
\ No newline at end of file
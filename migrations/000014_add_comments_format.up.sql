@@ -0,0 +1,3 @@
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS format text NOT NULL DEFAULT 'plain' CHECK (format IN ('plain', 'markdown'));
+
+ALTER TABLE comment_revisions ADD COLUMN IF NOT EXISTS format text NOT NULL DEFAULT 'plain';
\ No newline at end of file
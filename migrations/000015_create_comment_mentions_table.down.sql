@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS comment_mentions;
+
+ALTER TABLE users DROP COLUMN IF EXISTS notify_mentions;
\ No newline at end of file
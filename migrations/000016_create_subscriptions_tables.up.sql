@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS subscriptions (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    thread_id bigint REFERENCES threads ON DELETE CASCADE,
+    comment_id bigint REFERENCES comments ON DELETE CASCADE,
+    mode text NOT NULL DEFAULT 'immediate' CHECK (mode IN ('immediate', 'digest')),
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CHECK ((thread_id IS NULL) <> (comment_id IS NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS subscriptions_user_id_thread_id_idx ON subscriptions (user_id, thread_id) WHERE thread_id IS NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS subscriptions_user_id_comment_id_idx ON subscriptions (user_id, comment_id) WHERE comment_id IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS subscriptions_thread_id_idx ON subscriptions (thread_id);
+
+CREATE INDEX IF NOT EXISTS subscriptions_comment_id_idx ON subscriptions (comment_id);
+
+CREATE TABLE IF NOT EXISTS notifications (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    comment_id bigint NOT NULL REFERENCES comments ON DELETE CASCADE,
+    mode text NOT NULL,
+    created_at timestamp(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    sent_at timestamp(0) WITH TIME ZONE,
+    UNIQUE (user_id, comment_id)
+);
+
+CREATE INDEX IF NOT EXISTS notifications_unsent_idx ON notifications (mode, user_id) WHERE sent_at IS NULL;
\ No newline at end of file
@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE code = 'users:admin';
+
+ALTER TABLE users DROP COLUMN IF EXISTS disabled_at;
\ No newline at end of file
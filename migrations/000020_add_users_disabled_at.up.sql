@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled_at timestamp(0) WITH TIME ZONE;
+
+INSERT INTO permissions (code)
+VALUES ('users:admin')
+ON CONFLICT (code) DO NOTHING;
\ No newline at end of file
@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS roles (
+    id bigserial PRIMARY KEY,
+    code text NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS roles_permissions (
+    role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+    permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS users_roles (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+    PRIMARY KEY (user_id, role_id)
+);
+
+INSERT INTO roles (code)
+VALUES ('reader'), ('writer'), ('moderator'), ('admin')
+ON CONFLICT (code) DO NOTHING;
+
+INSERT INTO roles_permissions
+SELECT roles.id, permissions.id
+FROM (VALUES
+    ('reader', 'comments:read'),
+    ('writer', 'comments:read'),
+    ('writer', 'comments:write'),
+    ('moderator', 'comments:read'),
+    ('moderator', 'comments:write'),
+    ('moderator', 'comments:moderate'),
+    ('admin', 'comments:read'),
+    ('admin', 'comments:write'),
+    ('admin', 'comments:moderate'),
+    ('admin', 'emails:admin'),
+    ('admin', 'users:admin')
+) AS seed(role, permission)
+INNER JOIN roles ON roles.code = seed.role
+INNER JOIN permissions ON permissions.code = seed.permission
+ON CONFLICT DO NOTHING;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE comments DROP COLUMN IF EXISTS hidden_by_reports;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS hidden_by_reports bool NOT NULL DEFAULT false;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE comments DROP COLUMN IF EXISTS etag_version;
\ No newline at end of file
@@ -0,0 +1,5 @@
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS etag_version integer NOT NULL DEFAULT 1;
+
+-- Entity tags were built from the version until now, so starting from it
+-- keeps tags already held by clients from matching a later state.
+UPDATE comments SET etag_version = version;
\ No newline at end of file
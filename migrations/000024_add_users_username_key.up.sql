@@ -0,0 +1,6 @@
+-- Usernames differing only in case could be registered until now. All but
+-- the oldest of each are suffixed with their id so the index can be built.
+UPDATE users SET username = username || '-' || id
+WHERE id NOT IN (SELECT min(id) FROM users GROUP BY lower(username));
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_username_key ON users (lower(username));
\ No newline at end of file
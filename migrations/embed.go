@@ -0,0 +1,8 @@
+// Package migrations holds the SQL migrations for the database schema,
+// embedded so that cmd/api can apply them without the migrate CLI.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS